@@ -5,12 +5,19 @@ import (
 	"fmt"
 	"math/rand/v2"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/anngdinh/operator-helper/contexts/logid"
+	"github.com/anngdinh/operator-helper/logging"
 )
 
 type logUtilsKey string
 
+// keyLogID is the log field of the log ID, the context carries it with the logid package
 const keyLogID logUtilsKey = "id"
 const keyName logUtilsKey = "name"
 
@@ -20,26 +27,74 @@ type IContext struct {
 	name  string
 
 	mutex sync.Mutex
+
+	// nil when tracing is disabled
+	span trace.Span
+
+	// set by WithTimeout, stepParent is the context the step deadline was added to
+	step       string
+	timeout    time.Duration
+	stepParent context.Context
+
+	// goroutines started by Go, reset by Wait
+	group      *errgroup.Group
+	groupCtx   context.Context
+	groupLimit int
 }
 
+// NewContext wraps ctx, reusing its log ID and name if it has them. When tracing is enabled it starts a span,
+// which the caller must end with End.
 func NewContext(ctx context.Context) ContextWrapper {
+	return newContext(ctx, true)
+}
+
+// newContext only starts a span when withSpan is true, the other callers must not leave spans that are never ended.
+func newContext(ctx context.Context, withSpan bool) *IContext {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	var logId, name string
-	if value, ok := ctx.Value(keyLogID).(string); ok {
+	if value := logid.FromContext(ctx); value != "" {
 		logId = value
 	} else {
 		logId = randNumberWithThreeLetter()
-		ctx = context.WithValue(ctx, keyLogID, logId)
+		ctx = logid.NewContext(ctx, logId)
 	}
 	if value, ok := ctx.Value(keyName).(string); ok {
 		name = value
 	}
+	spanName := name
+	if spanName == "" {
+		spanName = defaultSpanName
+	}
+	var span trace.Span
+	if withSpan {
+		ctx, span = startSpan(ctx, spanName, logId)
+	}
 	return &IContext{
 		Context: ctx,
 		logId:   logId,
 		name:    name,
+		span:    span,
+	}
+}
+
+// asIContext returns ctx itself when it was created by this package, otherwise a new IContext on top of it
+// with the same log ID and name.
+func asIContext(ctx ContextWrapper) *IContext {
+	if s, ok := ctx.(*IContext); ok {
+		return s
+	}
+	logId := ctx.GetLogId()
+	var parent context.Context = ctx
+	if logid.FromContext(ctx) != logId {
+		parent = logid.NewContext(parent, logId)
+	}
+	name, _ := ctx.Value(keyName).(string)
+	return &IContext{
+		Context: parent,
+		logId:   logId,
+		name:    name,
 	}
 }
 
@@ -51,7 +106,11 @@ func (s *IContext) Log() *logrus.Entry {
 	if s.name != "" {
 		fields[string(keyName)] = s.name
 	}
-	return logrus.WithFields(fields)
+	if s.span != nil && s.span.SpanContext().HasTraceID() {
+		fields[keyTraceID] = s.span.SpanContext().TraceID().String()
+	}
+	// the log name is the component, so its level can be set apart from the others
+	return logging.ComponentLogger(logrus.StandardLogger(), s.name).WithFields(fields)
 }
 
 func (s *IContext) SetLogName(name string) ContextWrapper {
@@ -59,6 +118,9 @@ func (s *IContext) SetLogName(name string) ContextWrapper {
 	defer s.mutex.Unlock()
 	s.name = name
 	s.Context = context.WithValue(s.Context, keyName, name)
+	if s.span != nil {
+		s.span.SetName(name)
+	}
 	return s
 }
 
@@ -70,6 +132,15 @@ func (s *IContext) GetLogId() string {
 	return s.logId
 }
 
+// LogIdFromContext returns the log ID of ctx, also when the ContextWrapper carrying it was wrapped
+// by another context, e.g. by context.WithTimeout. It's empty when ctx has none.
+func LogIdFromContext(ctx context.Context) string {
+	if wrapper, ok := ctx.(ContextWrapper); ok {
+		return wrapper.GetLogId()
+	}
+	return logid.FromContext(ctx)
+}
+
 // ----------------------------------------------
 
 func randNumberWithThreeLetter() string {
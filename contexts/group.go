@@ -0,0 +1,103 @@
+package contexts
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Go calls fn in a new goroutine with errgroup semantics: the first goroutine that returns an error
+// cancels the context passed to the others, and the error is returned by Wait.
+// A panic in fn is recovered and turned into an error.
+// fn gets its own ContextWrapper sharing the log ID, its log name is "<parent name>/<name>",
+// so it can call SetLogName without touching the parent.
+// When a limit is set, Go blocks until the goroutine can be started without exceeding it.
+func (s *IContext) Go(name string, fn func(ctx ContextWrapper) error) {
+	group, groupCtx := s.getGroup()
+	child := s.derive(groupCtx, name)
+	group.Go(func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				child.Log().Errorf("goroutine panicked: %v\n%s", r, debug.Stack())
+				err = fmt.Errorf("goroutine %s panicked: %v", name, r)
+			}
+			child.End(err)
+		}()
+		if err := fn(child); err != nil {
+			return fmt.Errorf("goroutine %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// Wait blocks until all goroutines started by Go have returned, then returns the first non-nil error.
+// The ContextWrapper can start a new set of goroutines after Wait returns.
+// Goroutines started by Go while Wait blocks belong to the same set, Wait also waits for them.
+func (s *IContext) Wait() error {
+	s.mutex.Lock()
+	group := s.group
+	s.mutex.Unlock()
+
+	if group == nil {
+		return nil
+	}
+	err := group.Wait()
+
+	s.mutex.Lock()
+	if s.group == group {
+		s.group = nil
+		s.groupCtx = nil
+	}
+	s.mutex.Unlock()
+	return err
+}
+
+// SetLimit limits the number of active goroutines started by Go to at most n.
+// A value <= 0 removes the limit. The limit of a set of goroutines can't change once the first
+// one started, so a limit set before Wait returns applies to the next set.
+func (s *IContext) SetLimit(n int) GroupContextWrapper {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.groupLimit = n
+	return s
+}
+
+// AsGroup returns ctx as a GroupContextWrapper. The ContextWrapper returned by NewContext
+// implements it, any other ContextWrapper gets a new one on top of it sharing its log ID.
+func AsGroup(ctx ContextWrapper) GroupContextWrapper {
+	return asIContext(ctx)
+}
+
+// getGroup returns the group of the current set of goroutines, the limit is only applied to a new
+// group as errgroup can't change it while goroutines run.
+func (s *IContext) getGroup() (*errgroup.Group, context.Context) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.group == nil {
+		s.group, s.groupCtx = errgroup.WithContext(s.Context)
+		if s.groupLimit > 0 {
+			s.group.SetLimit(s.groupLimit)
+		}
+	}
+	return s.group, s.groupCtx
+}
+
+// derive creates a ContextWrapper on top of ctx with the same log ID and a sub name,
+// with a child span when tracing is enabled.
+func (s *IContext) derive(ctx context.Context, name string) *IContext {
+	s.mutex.Lock()
+	childName := name
+	if s.name != "" {
+		childName = s.name + "/" + name
+	}
+	s.mutex.Unlock()
+	ctx, span := startSpan(context.WithValue(ctx, keyName, childName), childName, s.logId)
+	return &IContext{
+		Context: ctx,
+		logId:   s.logId,
+		name:    childName,
+		span:    span,
+	}
+}
@@ -0,0 +1,191 @@
+package contexts
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoDerivesContext(t *testing.T) {
+	ctx := AsGroup(NewContext(context.Background()).SetLogName("reconcile"))
+
+	var mu sync.Mutex
+	names := map[string]string{}
+	for _, name := range []string{"lb", "listener"} {
+		ctx.Go(name, func(child ContextWrapper) error {
+			assert.Equal(t, ctx.GetLogId(), child.GetLogId())
+			mu.Lock()
+			names[name] = child.Log().Data[string(keyName)].(string)
+			mu.Unlock()
+			child.SetLogName("changed")
+			return nil
+		})
+	}
+
+	assert.NoError(t, ctx.Wait())
+	assert.Equal(t, map[string]string{"lb": "reconcile/lb", "listener": "reconcile/listener"}, names)
+	assert.Equal(t, "reconcile", ctx.Log().Data[string(keyName)])
+}
+
+func TestGoCancelsOnFirstError(t *testing.T) {
+	ctx := AsGroup(NewContext(context.Background()))
+	errDelete := errors.New("delete failed")
+
+	ctx.Go("failing", func(ContextWrapper) error {
+		return errDelete
+	})
+	ctx.Go("waiting", func(child ContextWrapper) error {
+		select {
+		case <-child.Done():
+			return child.Err()
+		case <-time.After(time.Second):
+			return errors.New("context was not cancelled")
+		}
+	})
+
+	err := ctx.Wait()
+	assert.ErrorIs(t, err, errDelete)
+	assert.Contains(t, err.Error(), "failing")
+	assert.NoError(t, ctx.Err(), "parent context must not be cancelled")
+}
+
+func TestGoRecoversPanic(t *testing.T) {
+	ctx := AsGroup(NewContext(context.Background()))
+
+	ctx.Go("panicking", func(ContextWrapper) error {
+		panic("boom")
+	})
+
+	err := ctx.Wait()
+	assert.ErrorContains(t, err, "goroutine panicking panicked: boom")
+}
+
+func TestGoLimit(t *testing.T) {
+	ctx := AsGroup(NewContext(context.Background())).SetLimit(2)
+
+	var active, maxActive int32
+	for i := 0; i < 10; i++ {
+		ctx.Go("worker", func(ContextWrapper) error {
+			n := atomic.AddInt32(&active, 1)
+			for {
+				old := atomic.LoadInt32(&maxActive)
+				if n <= old || atomic.CompareAndSwapInt32(&maxActive, old, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			return nil
+		})
+	}
+
+	assert.NoError(t, ctx.Wait())
+	assert.LessOrEqual(t, maxActive, int32(2))
+}
+
+func TestWaitWithoutGo(t *testing.T) {
+	ctx := AsGroup(NewContext(context.Background()))
+	assert.NoError(t, ctx.Wait())
+
+	ctx.Go("first", func(ContextWrapper) error { return errors.New("first round") })
+	assert.Error(t, ctx.Wait())
+
+	// a new round starts with a fresh group
+	ctx.Go("second", func(child ContextWrapper) error { return child.Err() })
+	assert.NoError(t, ctx.Wait())
+}
+
+func TestWaitIncludesGoroutinesStartedMeanwhile(t *testing.T) {
+	ctx := AsGroup(NewContext(context.Background()))
+
+	var nestedDone atomic.Bool
+	ctx.Go("parent", func(ContextWrapper) error {
+		ctx.Go("nested", func(ContextWrapper) error {
+			time.Sleep(10 * time.Millisecond)
+			nestedDone.Store(true)
+			return nil
+		})
+		return nil
+	})
+
+	assert.NoError(t, ctx.Wait())
+	assert.True(t, nestedDone.Load(), "Wait returned before the nested goroutine")
+}
+
+func TestSetLimitWhileRunning(t *testing.T) {
+	ctx := AsGroup(NewContext(context.Background()))
+
+	release := make(chan struct{})
+	ctx.Go("blocked", func(ContextWrapper) error {
+		<-release
+		return nil
+	})
+	assert.NotPanics(t, func() { ctx.SetLimit(1) })
+	// the limit applies to the next set, this one can still grow
+	ctx.Go("unlimited", func(ContextWrapper) error {
+		<-release
+		return nil
+	})
+	close(release)
+	assert.NoError(t, ctx.Wait())
+
+	var active, maxActive int32
+	for i := 0; i < 3; i++ {
+		ctx.Go("worker", func(ContextWrapper) error {
+			n := atomic.AddInt32(&active, 1)
+			if n > atomic.LoadInt32(&maxActive) {
+				atomic.StoreInt32(&maxActive, n)
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			return nil
+		})
+	}
+	assert.NoError(t, ctx.Wait())
+	assert.Equal(t, int32(1), maxActive)
+}
+
+func TestSetLimitAfterGoroutineReturns(t *testing.T) {
+	ctx := AsGroup(NewContext(context.Background()))
+	for i := 0; i < 100; i++ {
+		returned := make(chan struct{})
+		ctx.Go("quick", func(ContextWrapper) error {
+			close(returned)
+			return nil
+		})
+		<-returned
+		// errgroup may not have released the goroutine yet
+		ctx.SetLimit(i%3 + 1)
+		done := make(chan error)
+		go func() {
+			done <- ctx.Wait()
+		}()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("Wait hung after SetLimit")
+		}
+	}
+}
+
+type otherWrapper struct {
+	ContextWrapper
+}
+
+func TestAsGroupOtherWrapper(t *testing.T) {
+	parent := NewContext(context.Background()).SetLogName("reconcile")
+	ctx := AsGroup(otherWrapper{parent})
+
+	ctx.Go("child", func(child ContextWrapper) error {
+		assert.Equal(t, parent.GetLogId(), child.GetLogId())
+		assert.Equal(t, "reconcile/child", child.Log().Data[string(keyName)])
+		return nil
+	})
+	assert.NoError(t, ctx.Wait())
+}
@@ -0,0 +1,103 @@
+package contexts
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/anngdinh/operator-helper/contexts/logid"
+)
+
+// gRPC metadata keys carrying the ContextWrapper log ID and name, keys must be lowercase.
+const (
+	MetadataLogID = "x-request-id"
+	MetadataName  = "x-log-name"
+)
+
+// UnaryClientInterceptor copies the log ID and name of the call context into the outgoing gRPC metadata.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor copies the log ID and name of the stream context into the outgoing gRPC metadata.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingContext(ctx), desc, cc, method, opts...)
+	}
+}
+
+// UnaryServerInterceptor rebuilds a ContextWrapper from the incoming gRPC metadata and passes it to the handler,
+// a new log ID is generated when the client did not send one.
+// When tracing is enabled, the span of the call is ended with the error of the handler.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		callCtx := incomingContext(ctx, info.FullMethod)
+		resp, err := handler(callCtx, req)
+		callCtx.End(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor rebuilds a ContextWrapper from the incoming gRPC metadata,
+// it is returned by the Context() method of the stream passed to the handler.
+// When tracing is enabled, the span of the stream is ended with the error of the handler.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		streamCtx := incomingContext(ss.Context(), info.FullMethod)
+		err := handler(srv, &serverStream{
+			ServerStream: ss,
+			ctx:          streamCtx,
+		})
+		streamCtx.End(err)
+		return err
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx *IContext
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func outgoingContext(ctx context.Context) context.Context {
+	logId := LogIdFromContext(ctx)
+	var name string
+	if value, ok := ctx.Value(keyName).(string); ok {
+		name = value
+	}
+
+	kv := make([]string, 0, 4)
+	if logId != "" {
+		kv = append(kv, MetadataLogID, logId)
+	}
+	if name != "" {
+		kv = append(kv, MetadataName, name)
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// incomingContext starts the span of the call, named after method unless the client sent a log name.
+func incomingContext(ctx context.Context, method string) *IContext {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(MetadataLogID); len(values) > 0 && values[0] != "" {
+			ctx = logid.NewContext(ctx, values[0])
+		}
+		if values := md.Get(MetadataName); len(values) > 0 && values[0] != "" {
+			ctx = context.WithValue(ctx, keyName, values[0])
+		}
+	}
+	callCtx := newContext(ctx, true)
+	if callCtx.name == "" && callCtx.span != nil {
+		callCtx.span.SetName(method)
+	}
+	return callCtx
+}
@@ -0,0 +1,96 @@
+package contexts
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// healthServer records the ContextWrapper built by the server interceptors.
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+	received chan ContextWrapper
+}
+
+func (s *healthServer) Check(ctx context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if wrapper, ok := ctx.(ContextWrapper); ok {
+		s.received <- wrapper
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *healthServer) Watch(_ *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	if wrapper, ok := stream.Context().(ContextWrapper); ok {
+		s.received <- wrapper
+	}
+	return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
+
+func newBufconnClient(t *testing.T) (healthpb.HealthClient, *healthServer) {
+	t.Helper()
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor()),
+		grpc.StreamInterceptor(StreamServerInterceptor()),
+	)
+	health := &healthServer{received: make(chan ContextWrapper, 1)}
+	healthpb.RegisterHealthServer(server, health)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(StreamClientInterceptor()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return healthpb.NewHealthClient(conn), health
+}
+
+func TestGRPCUnaryInterceptorsPropagateLogId(t *testing.T) {
+	client, health := newBufconnClient(t)
+	ctx := NewContext(context.Background()).SetLogName("reconcile-lb")
+
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	got := <-health.received
+	assert.Equal(t, ctx.GetLogId(), got.GetLogId())
+	assert.Equal(t, "reconcile-lb", got.Log().Data[string(keyName)])
+}
+
+func TestGRPCStreamInterceptorsPropagateLogId(t *testing.T) {
+	client, health := newBufconnClient(t)
+	ctx := NewContext(context.Background())
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	got := <-health.received
+	assert.Equal(t, ctx.GetLogId(), got.GetLogId())
+}
+
+func TestGRPCServerInterceptorGeneratesLogId(t *testing.T) {
+	client, health := newBufconnClient(t)
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	got := <-health.received
+	assert.NotEmpty(t, got.GetLogId())
+}
@@ -2,6 +2,7 @@ package contexts
 
 import (
 	"context"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -19,3 +20,25 @@ type ContextWrapper interface {
 	// GetMessages() []string
 	// ClearMessages() ContextWrapper
 }
+
+// GroupContextWrapper is a ContextWrapper which can run goroutines with errgroup semantics.
+// It's not part of ContextWrapper so the implementations outside this package keep compiling,
+// AsGroup returns one for any ContextWrapper.
+type GroupContextWrapper interface {
+	ContextWrapper
+
+	// Go runs fn in a new goroutine with a derived ContextWrapper, the first error cancels the others.
+	Go(name string, fn func(ctx ContextWrapper) error)
+	// Wait blocks until all goroutines started by Go return, and returns the first error.
+	Wait() error
+	// SetLimit limits the number of goroutines started by Go that are active at once.
+	SetLimit(n int) GroupContextWrapper
+}
+
+// StepContextWrapper is the ContextWrapper of a step with a deadline, returned by WithTimeout.
+type StepContextWrapper interface {
+	ContextWrapper
+
+	// RequeueOnTimeout turns err into a NeedRequeueAfter when it's a deadline exceeded error.
+	RequeueOnTimeout(err error, requeueAfter time.Duration) error
+}
@@ -0,0 +1,18 @@
+// Package logid carries the log ID of the contexts package in a context.Context. It has no
+// dependency, so the packages only reading the log ID, such as multilock, don't import contexts.
+package logid
+
+import "context"
+
+type key struct{}
+
+// NewContext returns a copy of ctx carrying the log ID id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// FromContext returns the log ID carried by ctx or one of its parents, it's empty when there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(key{}).(string)
+	return id
+}
@@ -0,0 +1,17 @@
+package logid
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext(t *testing.T) {
+	assert.Empty(t, FromContext(context.Background()))
+
+	ctx, cancel := context.WithTimeout(NewContext(context.Background(), "1234"), time.Minute)
+	defer cancel()
+	assert.Equal(t, "1234", FromContext(ctx), "the log ID survives wrapping")
+}
@@ -0,0 +1,70 @@
+// Package otlp creates the TracerProvider enabling the tracing of the contexts package, kept apart
+// so the importers of contexts don't depend on the OpenTelemetry SDK and the OTLP exporter.
+package otlp
+
+import (
+	"context"
+	"crypto/rand"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/anngdinh/operator-helper/contexts"
+)
+
+// NewTracerProvider creates a TracerProvider exporting spans over OTLP/gRPC to a collector at endpoint,
+// e.g. "localhost:4317", to pass to contexts.SetTracerProvider.
+// The caller must Shutdown the provider on exit to flush the remaining spans.
+func NewTracerProvider(ctx context.Context, endpoint, serviceName string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithIDGenerator(IDGenerator()),
+	), nil
+}
+
+// IDGenerator returns a sdktrace.IDGenerator which derives the trace ID of a new trace from the log ID
+// of the context, see contexts.TraceIDFromLogId.
+// NewTracerProvider uses it, pass it with sdktrace.WithIDGenerator to other providers.
+func IDGenerator() sdktrace.IDGenerator {
+	return logIdGenerator{}
+}
+
+type logIdGenerator struct{}
+
+func (logIdGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	var traceID trace.TraceID
+	if logId := contexts.LogIdFromContext(ctx); logId != "" {
+		traceID = contexts.TraceIDFromLogId(logId)
+	}
+	if !traceID.IsValid() {
+		_, _ = rand.Read(traceID[:])
+	}
+	return traceID, newSpanID()
+}
+
+func (logIdGenerator) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
+	return newSpanID()
+}
+
+func newSpanID() trace.SpanID {
+	var spanID trace.SpanID
+	for !spanID.IsValid() {
+		_, _ = rand.Read(spanID[:])
+	}
+	return spanID
+}
@@ -0,0 +1,39 @@
+package otlp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/anngdinh/operator-helper/contexts"
+)
+
+func TestIDGeneratorTraceIDFromLogId(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithIDGenerator(IDGenerator()))
+	contexts.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		contexts.SetTracerProvider(nil)
+		_ = tp.Shutdown(context.Background())
+	})
+
+	ctx := contexts.NewContext(context.Background())
+	contexts.End(ctx, nil)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	traceID := contexts.TraceIDFromLogId(ctx.GetLogId())
+	assert.True(t, traceID.IsValid())
+	assert.Equal(t, traceID, spans[0].SpanContext.TraceID())
+	assert.Equal(t, traceID.String(), ctx.Log().Data["trace_id"])
+}
+
+func TestIDGeneratorWithoutLogId(t *testing.T) {
+	traceID, spanID := IDGenerator().NewIDs(context.Background())
+	assert.True(t, traceID.IsValid())
+	assert.True(t, spanID.IsValid())
+}
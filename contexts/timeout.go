@@ -0,0 +1,59 @@
+package contexts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/anngdinh/operator-helper/errs"
+)
+
+// WithTimeout derives a ContextWrapper from ctx for the named step with a deadline of timeout from now.
+// The derived context shares the log ID, its log name is "<parent name>/<step>".
+// Call the returned cancel function as soon as the step is done to release its resources,
+// it also ends the span of the step if End was not called before.
+func WithTimeout(ctx ContextWrapper, step string, timeout time.Duration) (StepContextWrapper, context.CancelFunc) {
+	return asIContext(ctx).WithTimeout(step, timeout)
+}
+
+// WithTimeout is the same as the WithTimeout function with s as the parent.
+func (s *IContext) WithTimeout(step string, timeout time.Duration) (StepContextWrapper, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(s.Context, timeout)
+	child := s.derive(ctx, step)
+	child.step = step
+	child.timeout = timeout
+	child.stepParent = s.Context
+	return child, func() {
+		cancel()
+		if child.span != nil {
+			child.span.End()
+		}
+	}
+}
+
+// RequeueOnTimeout returns errs.NewNeedRequeueAfter with a reason naming the step when err is a
+// context.DeadlineExceeded, so HandleReconcileError requeues it instead of treating it as an unknown error.
+// Any other error, including nil, is returned unchanged, so a client which doesn't wrap the context error
+// must be handled by the caller.
+//
+//	stepCtx, cancel := contexts.WithTimeout(ctx, "create-listener", 30*time.Second)
+//	defer cancel()
+//	err := stepCtx.RequeueOnTimeout(cloud.CreateListener(stepCtx, opts), 10*time.Second)
+func (s *IContext) RequeueOnTimeout(err error, requeueAfter time.Duration) error {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var reason string
+	switch {
+	case s.step == "":
+		reason = fmt.Sprintf("deadline exceeded: %v", err)
+	case errors.Is(s.Err(), context.DeadlineExceeded) && s.stepParent.Err() == nil:
+		reason = fmt.Sprintf("step %s timed out after %s: %v", s.step, s.timeout, err)
+	default:
+		// the deadline of a parent context or of the client fired, not the one of the step
+		reason = fmt.Sprintf("step %s: %v", s.step, err)
+	}
+	return errs.NewNeedRequeueAfter(reason, requeueAfter)
+}
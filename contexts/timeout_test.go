@@ -0,0 +1,73 @@
+package contexts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/anngdinh/operator-helper/errs"
+)
+
+func TestWithTimeoutRequeuesOnDeadline(t *testing.T) {
+	ctx := NewContext(context.Background()).SetLogName("reconcile")
+	stepCtx, cancel := WithTimeout(ctx, "create-listener", 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, ctx.GetLogId(), stepCtx.GetLogId())
+	assert.Equal(t, "reconcile/create-listener", stepCtx.Log().Data[string(keyName)])
+
+	<-stepCtx.Done()
+	err := stepCtx.RequeueOnTimeout(fmt.Errorf("create listener: %w", stepCtx.Err()), 3*time.Second)
+
+	var requeue *errs.NeedRequeueAfter
+	if assert.ErrorAs(t, err, &requeue) {
+		assert.Equal(t, 3*time.Second, requeue.Duration())
+		assert.Contains(t, requeue.Reason(), "step create-listener timed out after 10ms")
+	}
+	result, err := errs.HandleReconcileError(err, logrus.NewEntry(logrus.New()))
+	assert.NoError(t, err)
+	assert.Equal(t, 3*time.Second, result.RequeueAfter)
+	assert.NoError(t, ctx.Err(), "parent context must not be cancelled")
+}
+
+func TestRequeueOnTimeoutUnwrappedError(t *testing.T) {
+	stepCtx, cancel := WithTimeout(NewContext(context.Background()), "get-vpc", time.Millisecond)
+	defer cancel()
+	<-stepCtx.Done()
+
+	// the client lost the original context error, it's not guessed from the context state
+	errCanceled := errors.New("request canceled")
+	assert.Equal(t, errCanceled, stepCtx.RequeueOnTimeout(errCanceled, time.Second))
+}
+
+func TestRequeueOnTimeoutParentDeadline(t *testing.T) {
+	parentCtx, parentCancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer parentCancel()
+	stepCtx, cancel := WithTimeout(NewContext(parentCtx), "get-vpc", time.Minute)
+	defer cancel()
+	<-stepCtx.Done()
+
+	err := stepCtx.RequeueOnTimeout(stepCtx.Err(), time.Second)
+	var requeue *errs.NeedRequeueAfter
+	if assert.ErrorAs(t, err, &requeue) {
+		assert.Equal(t, "step get-vpc: context deadline exceeded", requeue.Reason())
+	}
+}
+
+func TestRequeueOnTimeoutKeepsOtherErrors(t *testing.T) {
+	stepCtx, cancel := WithTimeout(NewContext(context.Background()), "get-vpc", time.Minute)
+	defer cancel()
+
+	assert.NoError(t, stepCtx.RequeueOnTimeout(nil, time.Second))
+
+	errNotFound := errors.New("not found")
+	assert.Equal(t, errNotFound, stepCtx.RequeueOnTimeout(errNotFound, time.Second))
+
+	cancel()
+	assert.Equal(t, context.Canceled, stepCtx.RequeueOnTimeout(context.Canceled, time.Second))
+}
@@ -0,0 +1,128 @@
+package contexts
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/anngdinh/operator-helper/errs"
+)
+
+const tracerName = "github.com/anngdinh/operator-helper/contexts"
+
+// defaultSpanName is used by NewContext until SetLogName gives the span a better name.
+const defaultSpanName = "reconcile"
+
+// Span attributes set by the contexts package.
+const (
+	AttributeLogID        = attribute.Key("log.id")
+	AttributeOutcome      = attribute.Key("reconcile.outcome")
+	AttributeReason       = attribute.Key("reconcile.reason")
+	AttributeRequeueAfter = attribute.Key("reconcile.requeue_after")
+)
+
+// Values of AttributeOutcome, one for each errs type.
+const (
+	OutcomeSuccess      = "success"
+	OutcomeRequeue      = "requeue"
+	OutcomeRequeueAfter = "requeue_after"
+	OutcomeNoRequeue    = "no_requeue"
+	OutcomeError        = "error"
+)
+
+// keyTraceID is the log field holding the trace ID when tracing is enabled.
+const keyTraceID = "trace_id"
+
+var tracer atomic.Pointer[trace.Tracer]
+
+// SetTracerProvider enables tracing: NewContext, Go, WithTimeout and the gRPC server interceptors
+// start a span from a tracer of tp, and Log() adds the trace ID to every entry.
+// A nil tp disables tracing, which is the default.
+// tp should be created with otlp.IDGenerator so the trace ID can be found from the log ID.
+func SetTracerProvider(tp trace.TracerProvider) {
+	if tp == nil {
+		tracer.Store(nil)
+		return
+	}
+	t := tp.Tracer(tracerName)
+	tracer.Store(&t)
+}
+
+// TraceIDFromLogId returns the trace ID derived from logId, the same as in the traceparent sent
+// by Transport when tracing is disabled. It's used by the IDGenerator of the otlp package.
+func TraceIDFromLogId(logId string) trace.TraceID {
+	traceID, _ := trace.TraceIDFromHex(traceIDFromLogId(logId))
+	return traceID
+}
+
+// startSpan starts a span named name as a child of the span in ctx, if any.
+// It returns ctx unchanged and a nil span when tracing is disabled.
+func startSpan(ctx context.Context, name, logId string) (context.Context, trace.Span) {
+	t := tracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	return (*t).Start(ctx, name, trace.WithAttributes(AttributeLogID.String(logId)))
+}
+
+// End records the outcome of err on the span started by NewContext for ctx and ends it.
+// It does nothing when tracing is disabled or ctx has no span of its own, and only the first call has an effect.
+//
+//	ctx := contexts.NewContext(ctx).SetLogName("loadbalancer")
+//	err := r.reconcile(ctx, lb)
+//	contexts.End(ctx, err)
+//	return errs.HandleReconcileError(err, ctx.Log())
+func End(ctx ContextWrapper, err error) {
+	if ender, ok := ctx.(interface{ End(err error) }); ok {
+		ender.End(err)
+	}
+}
+
+// End is the same as the End function for s.
+func (s *IContext) End(err error) {
+	if s.span == nil || !s.span.IsRecording() {
+		return
+	}
+	recordOutcome(s.span, err)
+	s.span.End()
+}
+
+// recordOutcome maps the errs types to the span status: requeue errors are expected so they
+// leave the status unset and are only described by attributes, any other error marks the span as failed.
+func recordOutcome(span trace.Span, err error) {
+	if err == nil {
+		span.SetAttributes(AttributeOutcome.String(OutcomeSuccess))
+		span.SetStatus(codes.Ok, "")
+		return
+	}
+
+	var requeueNeededAfter *errs.NeedRequeueAfter
+	var requeueNeeded *errs.NeedRequeue
+	var noNeedRequeue *errs.NoNeedRequeue
+	switch {
+	case errors.As(err, &requeueNeededAfter):
+		span.SetAttributes(
+			AttributeOutcome.String(OutcomeRequeueAfter),
+			AttributeReason.String(requeueNeededAfter.Reason()),
+			AttributeRequeueAfter.String(requeueNeededAfter.Duration().String()),
+		)
+	case errors.As(err, &requeueNeeded):
+		span.SetAttributes(
+			AttributeOutcome.String(OutcomeRequeue),
+			AttributeReason.String(requeueNeeded.Reason()),
+		)
+	case errors.As(err, &noNeedRequeue):
+		span.SetAttributes(
+			AttributeOutcome.String(OutcomeNoRequeue),
+			AttributeReason.String(noNeedRequeue.Reason()),
+		)
+	default:
+		span.SetAttributes(AttributeOutcome.String(OutcomeError))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,163 @@
+package contexts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/anngdinh/operator-helper/errs"
+)
+
+func setupTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	SetTracerProvider(tp)
+	t.Cleanup(func() {
+		SetTracerProvider(nil)
+		_ = tp.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+func spanByName(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	require.Failf(t, "span not found", "no span named %q in %d spans", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+func attributeValue(span tracetest.SpanStub, key attribute.Key) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracingSpansPerStep(t *testing.T) {
+	exporter := setupTracing(t)
+
+	ctx := AsGroup(NewContext(context.Background()).SetLogName("loadbalancer"))
+	ctx.Go("delete-listener", func(ContextWrapper) error {
+		return nil
+	})
+	require.NoError(t, ctx.Wait())
+	stepCtx, cancel := WithTimeout(ctx, "update-pool", time.Minute)
+	End(stepCtx, errors.New("pool is busy"))
+	cancel()
+	End(ctx, errs.NewNeedRequeueAfter("waiting for listener", 5*time.Second))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	root := spanByName(t, spans, "loadbalancer")
+	goroutine := spanByName(t, spans, "loadbalancer/delete-listener")
+	step := spanByName(t, spans, "loadbalancer/update-pool")
+
+	for _, span := range spans {
+		assert.Equal(t, root.SpanContext.TraceID(), span.SpanContext.TraceID())
+		assert.Equal(t, ctx.GetLogId(), attributeValue(span, AttributeLogID))
+	}
+	assert.Equal(t, root.SpanContext.SpanID(), goroutine.Parent.SpanID())
+	assert.Equal(t, root.SpanContext.SpanID(), step.Parent.SpanID())
+
+	assert.Equal(t, OutcomeRequeueAfter, attributeValue(root, AttributeOutcome))
+	assert.Equal(t, "waiting for listener", attributeValue(root, AttributeReason))
+	assert.Equal(t, "5s", attributeValue(root, AttributeRequeueAfter))
+	assert.Equal(t, codes.Unset, root.Status.Code)
+
+	assert.Equal(t, OutcomeSuccess, attributeValue(goroutine, AttributeOutcome))
+	assert.Equal(t, codes.Ok, goroutine.Status.Code)
+
+	assert.Equal(t, OutcomeError, attributeValue(step, AttributeOutcome))
+	assert.Equal(t, codes.Error, step.Status.Code)
+	assert.Equal(t, "pool is busy", step.Status.Description)
+
+	assert.Equal(t, root.SpanContext.TraceID().String(), ctx.Log().Data[keyTraceID])
+}
+
+func TestTracingEndOnlyOnce(t *testing.T) {
+	exporter := setupTracing(t)
+
+	ctx := NewContext(context.Background())
+	End(ctx, nil)
+	End(ctx, errors.New("ignored"))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, defaultSpanName, spans[0].Name)
+	assert.Equal(t, codes.Ok, spans[0].Status.Code)
+}
+
+func TestTracingTransportUsesSpanContext(t *testing.T) {
+	setupTracing(t)
+
+	var gotTraceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get(HeaderTraceparent)
+	}))
+	defer server.Close()
+
+	ctx := NewContext(context.Background())
+	defer End(ctx, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := NewTransport(nil).RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	traceID := ctx.Log().Data[keyTraceID].(string)
+	assert.True(t, strings.HasPrefix(gotTraceparent, "00-"+traceID+"-"), gotTraceparent)
+}
+
+func TestTracingDisabled(t *testing.T) {
+	ctx := NewContext(context.Background())
+	End(ctx, nil)
+	_, ok := ctx.Log().Data[keyTraceID]
+	assert.False(t, ok)
+}
+
+func TestTracingGRPCServerEndsSpan(t *testing.T) {
+	exporter := setupTracing(t)
+	client, health := newBufconnClient(t)
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	<-health.received
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, healthpb.Health_Check_FullMethodName, spans[0].Name)
+	assert.Equal(t, OutcomeSuccess, attributeValue(spans[0], AttributeOutcome))
+}
+
+func TestTracingTransportStartsNoSpan(t *testing.T) {
+	exporter := setupTracing(t)
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := NewTransport(nil).RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Empty(t, exporter.GetSpans())
+}
@@ -0,0 +1,150 @@
+package contexts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/anngdinh/operator-helper/logging"
+)
+
+const (
+	HeaderRequestID   = "X-Request-ID"
+	HeaderTraceparent = "traceparent"
+)
+
+var _ http.RoundTripper = &Transport{}
+
+// Transport is a http.RoundTripper that propagates the log ID of the request context
+// as X-Request-ID and traceparent headers, and logs every round trip through ContextWrapper.Log().
+type Transport struct {
+	// Base is the underlying RoundTripper, http.DefaultTransport is used when nil.
+	Base http.RoundTripper
+}
+
+// NewTransport wraps base with a Transport, http.DefaultTransport is used when base is nil.
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{
+		Base: base,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := contextFromRequest(req)
+
+	// RoundTripper must not modify the original request
+	req = req.Clone(req.Context())
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	if req.Header.Get(HeaderRequestID) == "" {
+		req.Header.Set(HeaderRequestID, ctx.GetLogId())
+	}
+	if req.Header.Get(HeaderTraceparent) == "" {
+		if sc := trace.SpanContextFromContext(req.Context()); sc.IsValid() {
+			req.Header.Set(HeaderTraceparent, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-"+sc.TraceFlags().String())
+		} else {
+			req.Header.Set(HeaderTraceparent, newTraceparent(ctx.GetLogId()))
+		}
+	}
+
+	log := ctx.Log().WithFields(logrus.Fields{
+		"method": req.Method,
+		"url":    redactURL(req.URL),
+	})
+	log.WithField("headers", redactHeader(req.Header)).Debug("sending http request")
+
+	start := time.Now()
+	resp, err := t.base().RoundTrip(req)
+	log = log.WithField("latency", time.Since(start).String())
+	if err != nil {
+		log.Warnf("http request failed: %v", err)
+		return resp, err
+	}
+	log.WithField("status", resp.StatusCode).Info("http request done")
+	return resp, nil
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func contextFromRequest(req *http.Request) ContextWrapper {
+	if ctx, ok := req.Context().(ContextWrapper); ok {
+		return ctx
+	}
+	// nobody would end a span started here
+	return newContext(req.Context(), false)
+}
+
+// newTraceparent is used when tracing is disabled, it builds a W3C traceparent header whose trace-id is derived from the log ID,
+// so the same log ID always maps to the same trace-id on the provider side.
+func newTraceparent(logId string) string {
+	parentId := make([]byte, 8)
+	_, _ = rand.Read(parentId)
+	return "00-" + traceIDFromLogId(logId) + "-" + hex.EncodeToString(parentId) + "-01"
+}
+
+// traceIDFromLogId left pads a hexadecimal log ID to 32 characters so it stays readable in the trace-id,
+// any other log ID is hashed.
+func traceIDFromLogId(logId string) string {
+	logId = strings.ToLower(logId)
+	if logId != "" && len(logId) <= 32 && isHex(logId) && strings.Trim(logId, "0") != "" {
+		return strings.Repeat("0", 32-len(logId)) + logId
+	}
+	sum := sha256.Sum256([]byte(logId))
+	return hex.EncodeToString(sum[:16])
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	if redacted.User != nil {
+		redacted.User = url.User(redacted.User.Username())
+	}
+	if redacted.RawQuery != "" {
+		query := redacted.Query()
+		for name, values := range query {
+			if logging.IsSecretName(name) {
+				for i := range values {
+					values[i] = logging.RedactedValue
+				}
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+func redactHeader(header http.Header) map[string]string {
+	result := make(map[string]string, len(header))
+	for name, values := range header {
+		if logging.IsSecretName(name) {
+			result[name] = logging.RedactedValue
+			continue
+		}
+		result[name] = strings.Join(values, ",")
+	}
+	return result
+}
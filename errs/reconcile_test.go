@@ -8,6 +8,8 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/anngdinh/operator-helper/logging/loggingtest"
 )
 
 func TestHandleReconcileError(t *testing.T) {
@@ -71,3 +73,14 @@ func TestHandleReconcileError(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleReconcileErrorLogs(t *testing.T) {
+	logger, capture := loggingtest.NewLogger()
+	log := logger.WithField("id", "1234")
+
+	_, _ = HandleReconcileError(NewNeedRequeueAfter("waiting for listener", 3*time.Second), log)
+	capture.RequireLogged(t, logrus.InfoLevel, "reason: waiting for listener", logrus.Fields{"id": "1234"})
+
+	_, _ = HandleReconcileError(NewNoNeedRequeue("object deleted"), log)
+	capture.RequireLogged(t, logrus.InfoLevel, "no need to requeue, reason: object deleted", nil)
+}
@@ -0,0 +1,213 @@
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ComponentField is the field naming the component of an entry, see WithComponent.
+const ComponentField = "component"
+
+// defaultComponent is the key of the default level in a level spec.
+const defaultComponent = "default"
+
+// ComponentLevels holds a log level per component, with a default level for the others.
+type ComponentLevels struct {
+	Default    logrus.Level
+	Components map[string]logrus.Level
+}
+
+// WithComponent returns an entry of ComponentLogger(logrus.StandardLogger(), component) tagged with component.
+func WithComponent(component string) *logrus.Entry {
+	return ComponentLogger(logrus.StandardLogger(), component).WithField(ComponentField, component)
+}
+
+// ParseComponentLevels parses a level spec such as "loadbalancer=debug,notify=warn,default=info".
+// An entry without a component, e.g. "debug", sets the default level, which is info when not given.
+func ParseComponentLevels(spec string) (*ComponentLevels, error) {
+	levels := &ComponentLevels{
+		Default:    logrus.InfoLevel,
+		Components: map[string]logrus.Level{},
+	}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		component, levelStr, found := strings.Cut(item, "=")
+		if !found {
+			component, levelStr = defaultComponent, item
+		}
+		component = strings.TrimSpace(component)
+		if component == "" {
+			return nil, fmt.Errorf("invalid log level spec %q: empty component", item)
+		}
+		level, err := logrus.ParseLevel(strings.TrimSpace(levelStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level spec %q: %w", item, err)
+		}
+		if component == defaultComponent {
+			levels.Default = level
+		} else {
+			levels.Components[component] = level
+		}
+	}
+	return levels, nil
+}
+
+// LevelFor returns the level of component. A component without its own level inherits the level of
+// its closest parent, components being separated by "/" or ".": "loadbalancer/delete-listener"
+// falls back to "loadbalancer", then to the default level.
+func (c *ComponentLevels) LevelFor(component string) logrus.Level {
+	for component != "" {
+		if level, ok := c.Components[component]; ok {
+			return level
+		}
+		i := strings.LastIndexAny(component, "/.")
+		if i < 0 {
+			break
+		}
+		component = component[:i]
+	}
+	return c.Default
+}
+
+// MaxLevel returns the most verbose level of all components.
+func (c *ComponentLevels) MaxLevel() logrus.Level {
+	level := c.Default
+	for _, l := range c.Components {
+		if l > level {
+			level = l
+		}
+	}
+	return level
+}
+
+// Enabled reports whether an entry of level for component would be written.
+func (c *ComponentLevels) Enabled(component string, level logrus.Level) bool {
+	return level <= c.LevelFor(component)
+}
+
+func (c *ComponentLevels) String() string {
+	items := make([]string, 0, len(c.Components)+1)
+	for component, level := range c.Components {
+		items = append(items, component+"="+level.String())
+	}
+	sort.Strings(items)
+	return strings.Join(append(items, defaultComponent+"="+c.Default.String()), ",")
+}
+
+// componentLoggers holds the levelLoggers of every logger given to SetComponentLevels.
+var componentLoggers sync.Map
+
+// levelLoggers holds the component levels of a logger, and the loggers of the levels other than
+// the default one. There is one logger per level rather than per component, so there are at most
+// len(logrus.AllLevels) of them whatever the number of components.
+type levelLoggers struct {
+	mutex   sync.RWMutex
+	levels  *ComponentLevels
+	loggers map[logrus.Level]*logrus.Logger
+}
+
+// SetComponentLevels sets the level of logger to levels.Default, and the levels used by ComponentLogger.
+func SetComponentLevels(logger *logrus.Logger, levels *ComponentLevels) {
+	value, _ := componentLoggers.LoadOrStore(logger, &levelLoggers{loggers: map[logrus.Level]*logrus.Logger{}})
+	set := value.(*levelLoggers)
+	set.mutex.Lock()
+	set.levels = levels
+	for _, child := range set.loggers {
+		child.SetReportCaller(logger.ReportCaller)
+	}
+	set.mutex.Unlock()
+	logger.SetLevel(levels.Default)
+}
+
+// setDefaultLevel changes the default level of the component levels of logger, if any, and its level.
+func setDefaultLevel(logger *logrus.Logger, level logrus.Level) {
+	if value, ok := componentLoggers.Load(logger); ok {
+		set := value.(*levelLoggers)
+		set.mutex.Lock()
+		levels := &ComponentLevels{Default: level, Components: set.levels.Components}
+		set.levels = levels
+		set.mutex.Unlock()
+	}
+	logger.SetLevel(level)
+}
+
+// ComponentLogger returns a logger at the level of component in the levels set on logger by Configure
+// or SetComponentLevels, so the entries of a disabled level are dropped before being built, like with
+// any logrus logger. It's logger itself when component is at the default level, otherwise a logger
+// sharing its output, formatter and hooks. The change of those of logger made afterwards are followed,
+// except for SetReportCaller which must be called before Configure. The output of logger must be safe
+// for concurrent writes, like os.Stderr or a RotatingFile.
+func ComponentLogger(logger *logrus.Logger, component string) *logrus.Logger {
+	value, ok := componentLoggers.Load(logger)
+	if !ok || component == "" {
+		return logger
+	}
+	set := value.(*levelLoggers)
+	set.mutex.RLock()
+	level := set.levels.LevelFor(component)
+	child, ok := set.loggers[level]
+	isDefault := level == set.levels.Default
+	set.mutex.RUnlock()
+	if isDefault {
+		return logger
+	}
+	if ok {
+		return child
+	}
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	if child, ok := set.loggers[level]; ok {
+		return child
+	}
+	child = newChildLogger(logger, level)
+	set.loggers[level] = child
+	return child
+}
+
+// newChildLogger returns a logger at level writing through parent.
+func newChildLogger(parent *logrus.Logger, level logrus.Level) *logrus.Logger {
+	child := logrus.New()
+	child.Out = parentWriter{parent: parent}
+	child.Formatter = parentFormatter{parent: parent}
+	child.Hooks.Add(parentHooks{parent: parent})
+	child.ReportCaller = parent.ReportCaller
+	child.Level = level
+	child.ExitFunc = parent.Exit
+	return child
+}
+
+type parentWriter struct {
+	parent *logrus.Logger
+}
+
+func (w parentWriter) Write(p []byte) (int, error) {
+	return w.parent.Out.Write(p)
+}
+
+type parentFormatter struct {
+	parent *logrus.Logger
+}
+
+func (f parentFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	return f.parent.Formatter.Format(entry)
+}
+
+type parentHooks struct {
+	parent *logrus.Logger
+}
+
+func (h parentHooks) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h parentHooks) Fire(entry *logrus.Entry) error {
+	return h.parent.Hooks.Fire(entry.Level, entry)
+}
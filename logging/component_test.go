@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseComponentLevels(t *testing.T) {
+	levels, err := ParseComponentLevels(" loadbalancer=debug, notify=warn,default=error ")
+	require.NoError(t, err)
+	assert.Equal(t, logrus.ErrorLevel, levels.Default)
+	assert.Equal(t, map[string]logrus.Level{
+		"loadbalancer": logrus.DebugLevel,
+		"notify":       logrus.WarnLevel,
+	}, levels.Components)
+	assert.Equal(t, logrus.DebugLevel, levels.MaxLevel())
+	assert.Equal(t, "loadbalancer=debug,notify=warning,default=error", levels.String())
+
+	levels, err = ParseComponentLevels("debug")
+	require.NoError(t, err)
+	assert.Equal(t, logrus.DebugLevel, levels.Default)
+	assert.Empty(t, levels.Components)
+
+	levels, err = ParseComponentLevels("")
+	require.NoError(t, err)
+	assert.Equal(t, logrus.InfoLevel, levels.Default)
+
+	for _, spec := range []string{"verbose", "loadbalancer=verbose", "=debug"} {
+		_, err = ParseComponentLevels(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestComponentLevelsLevelFor(t *testing.T) {
+	levels, err := ParseComponentLevels("loadbalancer=debug,controller-runtime=warn")
+	require.NoError(t, err)
+
+	assert.Equal(t, logrus.DebugLevel, levels.LevelFor("loadbalancer"))
+	assert.Equal(t, logrus.DebugLevel, levels.LevelFor("loadbalancer/delete-listener"))
+	assert.Equal(t, logrus.WarnLevel, levels.LevelFor("controller-runtime.metrics"))
+	assert.Equal(t, logrus.InfoLevel, levels.LevelFor("listener"))
+	assert.Equal(t, logrus.InfoLevel, levels.LevelFor(""))
+}
+
+func TestConfigureComponentLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	require.NoError(t, Configure(logger, Config{Level: "loadbalancer=debug,notify=warn,default=info"}))
+	assert.Equal(t, logrus.InfoLevel, logger.GetLevel())
+
+	ComponentLogger(logger, "loadbalancer").Debug("lb-debug")
+	ComponentLogger(logger, "loadbalancer/delete-listener").Debug("lb-goroutine-debug")
+	ComponentLogger(logger, "notify").Info("notify-info")
+	ComponentLogger(logger, "notify").Warn("notify-warn")
+	ComponentLogger(logger, "listener").Debug("listener-debug")
+	logger.Debug("default-debug")
+	logger.Info("default-info")
+
+	output := buf.String()
+	assert.Contains(t, output, "lb-debug")
+	assert.Contains(t, output, "lb-goroutine-debug")
+	assert.NotContains(t, output, "notify-info")
+	assert.Contains(t, output, "notify-warn")
+	assert.NotContains(t, output, "listener-debug")
+	assert.NotContains(t, output, "default-debug")
+	assert.Contains(t, output, "default-info")
+
+	assert.Same(t, logger, ComponentLogger(logger, "listener"), "the default level uses logger itself")
+	assert.Same(t, ComponentLogger(logger, "loadbalancer"), ComponentLogger(logger, "loadbalancer/pool"),
+		"components of the same level share a logger")
+
+	// reconfiguring with a single level removes the component levels
+	require.NoError(t, Configure(logger, Config{Level: "warn"}))
+	assert.Same(t, logger, ComponentLogger(logger, "loadbalancer"))
+	assert.Equal(t, logrus.WarnLevel, logger.GetLevel())
+}
+
+func TestComponentLevelsSkipHooks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	hook := test.NewLocal(logger)
+	require.NoError(t, Configure(logger, Config{Level: "loadbalancer=debug,notify=warn"}))
+
+	ComponentLogger(logger, "notify").Info("notify-info")
+	ComponentLogger(logger, "loadbalancer").Debug("lb-debug")
+
+	require.Len(t, hook.AllEntries(), 1, "hooks must not see the entries of disabled levels")
+	assert.Equal(t, "lb-debug", hook.LastEntry().Message)
+}
+
+func TestSetLevelUpdatesDefaultComponentLevel(t *testing.T) {
+	logger := logrus.StandardLogger()
+	oldLevel, oldFormatter, oldOut := logger.GetLevel(), logger.Formatter, logger.Out
+	t.Cleanup(func() {
+		componentLoggers.Delete(logger)
+		logger.SetLevel(oldLevel)
+		logger.SetFormatter(oldFormatter)
+		logger.SetOutput(oldOut)
+		logger.SetReportCaller(false)
+	})
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	require.NoError(t, Configure(logger, Config{Level: "notify=warn,default=info"}))
+
+	require.NoError(t, SetLevel("debug"))
+	WithComponent("listener").Debug("listener-debug")
+	WithComponent("notify").Info("notify-info")
+
+	assert.Contains(t, buf.String(), "listener-debug")
+	assert.NotContains(t, buf.String(), "notify-info")
+}
+
+func TestComponentFilterWithLogr(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	require.NoError(t, Configure(logger, Config{Level: "controller-runtime=error,default=debug"}))
+
+	log := NewLogr(logger).WithName("controller-runtime").WithName("metrics")
+	log.Info("metrics-info")
+	NewLogr(logger).WithName("operator").V(1).Info("operator-debug")
+
+	assert.NotContains(t, buf.String(), "metrics-info")
+	assert.Contains(t, buf.String(), "operator-debug")
+}
+
+func BenchmarkComponentLogger(b *testing.B) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	if err := Configure(logger, Config{Level: "loadbalancer=debug,notify=warn,default=info"}); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ComponentLogger(logger, "listener/update-pool").Debug("filtered")
+	}
+}
@@ -0,0 +1,318 @@
+package logging
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/utils/clock"
+)
+
+// backupTimeFormat is the timestamp added to the name of the rotated files, it sorts chronologically.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// FileConfig configures a RotatingFile.
+type FileConfig struct {
+	// Path of the log file, its directory is created if needed.
+	Path string
+	// MaxSize in bytes rotates the file before a write would make it bigger, 0 disables it.
+	MaxSize int64
+	// MaxAge rotates the file once it has been open for this long, 0 disables it.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files to keep, 0 keeps all of them.
+	MaxBackups int
+	// Compress gzips the rotated files.
+	Compress bool
+	// Stdout also writes the logs to stdout, used by SetupFileOutput.
+	Stdout bool
+	// Clock is the real clock when nil.
+	Clock clock.PassiveClock
+}
+
+var _ io.WriteCloser = &RotatingFile{}
+
+// RotatingFile is an io.Writer appending to a file which is rotated by size and age.
+// A rotated file is renamed with a timestamp, e.g. operator-2024-01-02T15-04-05.000.log,
+// then compressed and pruned in the background.
+type RotatingFile struct {
+	config FileConfig
+
+	mutex sync.Mutex
+	// file is nil after Close, or after a failed rotation or Reopen until the next write opens it again
+	file     *os.File
+	closed   bool
+	size     int64
+	openedAt time.Time
+
+	// millMutex serializes the compression and pruning of the rotated files
+	millMutex sync.Mutex
+	millWg    sync.WaitGroup
+}
+
+// NewRotatingFile opens the file described by config in append mode.
+func NewRotatingFile(config FileConfig) (*RotatingFile, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("log file path is empty")
+	}
+	if config.Clock == nil {
+		config.Clock = clock.RealClock{}
+	}
+	r := &RotatingFile{config: config}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetupFileOutput makes logger write to a RotatingFile, and to stdout as well when config.Stdout is set.
+// The formatter of logger is kept. The caller should Close the returned file on exit.
+func SetupFileOutput(logger *logrus.Logger, config FileConfig) (*RotatingFile, error) {
+	file, err := NewRotatingFile(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Stdout {
+		logger.SetOutput(io.MultiWriter(os.Stdout, file))
+	} else {
+		logger.SetOutput(file)
+	}
+	return file, nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.file != nil && r.shouldRotate(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			// the logger may write to this file, so report it on stderr and keep logging, the
+			// rotation is attempted again on the next write
+			fmt.Fprintf(os.Stderr, "failed to rotate log file %s: %v\n", r.config.Path, err)
+		}
+	}
+	if r.file == nil {
+		// a failed rotation or Reopen left no file open, try again rather than losing the logs
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current file, renames it with a timestamp and opens a new one.
+func (r *RotatingFile) Rotate() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	return r.rotate()
+}
+
+// Reopen closes and opens the file again at the same path, for external tools such as logrotate
+// which moved the file away.
+func (r *RotatingFile) Reopen() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+		r.file = nil
+	}
+	return r.open()
+}
+
+// ReopenOnSignal calls Reopen on every SIGHUP until ctx is done.
+func (r *RotatingFile) ReopenOnSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			if err := r.Reopen(); err != nil {
+				// the logger may write to this file, so report it on stderr
+				fmt.Fprintf(os.Stderr, "failed to reopen log file %s: %v\n", r.config.Path, err)
+			}
+		}
+	}
+}
+
+// Close closes the file and waits for the rotated files to be compressed and pruned.
+func (r *RotatingFile) Close() error {
+	r.mutex.Lock()
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.closed = true
+	r.mutex.Unlock()
+	r.millWg.Wait()
+	return err
+}
+
+func (r *RotatingFile) shouldRotate(writeSize int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.config.MaxSize > 0 && r.size+writeSize > r.config.MaxSize {
+		return true
+	}
+	return r.config.MaxAge > 0 && r.config.Clock.Since(r.openedAt) >= r.config.MaxAge
+}
+
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.config.Path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = r.config.Clock.Now()
+	return nil
+}
+
+func (r *RotatingFile) rotate() error {
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+		r.file = nil
+	}
+	backup := r.backupName(r.config.Clock.Now())
+	if err := os.Rename(r.config.Path, backup); err != nil && !os.IsNotExist(err) {
+		// keep appending to the current file
+		if openErr := r.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.millWg.Add(1)
+	go func() {
+		defer r.millWg.Done()
+		r.mill(backup)
+	}()
+	return nil
+}
+
+// backupName returns the name of a file rotated at t. When a backup of the same millisecond
+// already exists, compressed or not, t is moved forward until the name is free, so the backups
+// keep sorting chronologically.
+func (r *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(r.config.Path)
+	prefix := strings.TrimSuffix(r.config.Path, ext)
+	for {
+		name := prefix + "-" + t.Format(backupTimeFormat) + ext
+		if !fileExists(name) && !fileExists(name+".gz") {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return !os.IsNotExist(err)
+}
+
+// mill compresses the backup if needed and removes the oldest backups.
+func (r *RotatingFile) mill(backup string) {
+	r.millMutex.Lock()
+	defer r.millMutex.Unlock()
+
+	if r.config.Compress {
+		// the backup may already be pruned by the mill of a later rotation
+		if err := compressFile(backup); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "failed to compress log file %s: %v\n", backup, err)
+		}
+	}
+	if r.config.MaxBackups > 0 {
+		backups := r.backups()
+		for i := 0; i < len(backups)-r.config.MaxBackups; i++ {
+			_ = os.Remove(backups[i])
+		}
+	}
+}
+
+// backups returns the rotated files, oldest first. The directory is listed rather than globbed
+// as the path may contain glob metacharacters.
+func (r *RotatingFile) backups() []string {
+	dir := filepath.Dir(r.config.Path)
+	ext := filepath.Ext(r.config.Path)
+	prefix := strings.TrimSuffix(filepath.Base(r.config.Path), ext) + "-"
+	entries, _ := os.ReadDir(dir)
+
+	var backups []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".gz"), ext)
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(name, prefix)); err == nil {
+			backups = append(backups, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(backups)
+	return backups
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(dst)
+	if _, err := io.Copy(writer, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,185 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestRotatingFileMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	fakeClock := clocktesting.NewFakePassiveClock(time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC))
+	file, err := NewRotatingFile(FileConfig{Path: filepath.Join(dir, "operator.log"), MaxSize: 10, Clock: fakeClock})
+	require.NoError(t, err)
+
+	_, err = file.Write([]byte("12345678\n"))
+	require.NoError(t, err)
+	fakeClock.SetTime(fakeClock.Now().Add(time.Second))
+	_, err = file.Write([]byte("abc\n"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	assert.Equal(t, "abc\n", readFile(t, filepath.Join(dir, "operator.log")))
+	assert.Equal(t, "12345678\n", readFile(t, filepath.Join(dir, "operator-2024-01-02T15-04-06.000.log")))
+}
+
+func TestRotatingFileMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	fakeClock := clocktesting.NewFakePassiveClock(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	file, err := NewRotatingFile(FileConfig{Path: filepath.Join(dir, "operator.log"), MaxAge: time.Hour, Clock: fakeClock})
+	require.NoError(t, err)
+
+	_, err = file.Write([]byte("first\n"))
+	require.NoError(t, err)
+	fakeClock.SetTime(fakeClock.Now().Add(30 * time.Minute))
+	_, err = file.Write([]byte("second\n"))
+	require.NoError(t, err)
+	fakeClock.SetTime(fakeClock.Now().Add(30 * time.Minute))
+	_, err = file.Write([]byte("third\n"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	assert.Equal(t, "third\n", readFile(t, filepath.Join(dir, "operator.log")))
+	assert.Equal(t, "first\nsecond\n", readFile(t, filepath.Join(dir, "operator-2024-01-02T01-00-00.000.log")))
+}
+
+func TestRotatingFileCompressAndMaxBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "operator.log")
+	fakeClock := clocktesting.NewFakePassiveClock(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	file, err := NewRotatingFile(FileConfig{Path: path, MaxBackups: 2, Compress: true, Clock: fakeClock})
+	require.NoError(t, err)
+
+	for _, line := range []string{"a\n", "b\n", "c\n", "d\n"} {
+		_, err = file.Write([]byte(line))
+		require.NoError(t, err)
+		fakeClock.SetTime(fakeClock.Now().Add(time.Minute))
+		require.NoError(t, file.Rotate())
+	}
+	require.NoError(t, file.Close())
+
+	backups := file.backups()
+	require.Len(t, backups, 2)
+	assert.Equal(t, filepath.Join(dir, "operator-2024-01-02T00-03-00.000.log.gz"), backups[0])
+	assert.Equal(t, "c\n", readGzip(t, backups[0]))
+	assert.Equal(t, "d\n", readGzip(t, backups[1]))
+}
+
+func TestRotatingFileSameMillisecond(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs[1]")
+	path := filepath.Join(dir, "operator.log")
+	fakeClock := clocktesting.NewFakePassiveClock(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	file, err := NewRotatingFile(FileConfig{Path: path, MaxBackups: 2, Compress: true, Clock: fakeClock})
+	require.NoError(t, err)
+
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		_, err = file.Write([]byte(line))
+		require.NoError(t, err)
+		require.NoError(t, file.Rotate())
+	}
+	require.NoError(t, file.Close())
+
+	backups := file.backups()
+	require.Len(t, backups, 2, "the backups are found in a directory with glob metacharacters")
+	assert.Equal(t, filepath.Join(dir, "operator-2024-01-02T00-00-00.001.log.gz"), backups[0])
+	assert.Equal(t, "b\n", readGzip(t, backups[0]))
+	assert.Equal(t, filepath.Join(dir, "operator-2024-01-02T00-00-00.002.log.gz"), backups[1])
+	assert.Equal(t, "c\n", readGzip(t, backups[1]))
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "operator.log")
+	file, err := NewRotatingFile(FileConfig{Path: path})
+	require.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.Write([]byte("before\n"))
+	require.NoError(t, err)
+	// an external tool moves the file away
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, file.Reopen())
+	_, err = file.Write([]byte("after\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "before\n", readFile(t, path+".1"))
+	assert.Equal(t, "after\n", readFile(t, path))
+}
+
+func TestRotatingFileRecoversFromFailedReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "operator.log")
+	file, err := NewRotatingFile(FileConfig{Path: path})
+	require.NoError(t, err)
+	defer file.Close()
+
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, os.Mkdir(path, 0o755))
+	assert.Error(t, file.Reopen())
+	_, err = file.Write([]byte("lost\n"))
+	assert.Error(t, err)
+
+	// the next write opens the file again once it's possible
+	require.NoError(t, os.Remove(path))
+	_, err = file.Write([]byte("after\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "after\n", readFile(t, path))
+}
+
+func TestRotatingFileClosed(t *testing.T) {
+	file, err := NewRotatingFile(FileConfig{Path: filepath.Join(t.TempDir(), "operator.log")})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	_, err = file.Write([]byte("closed\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+	assert.ErrorIs(t, file.Rotate(), os.ErrClosed)
+	assert.ErrorIs(t, file.Reopen(), os.ErrClosed)
+
+	_, err = NewRotatingFile(FileConfig{})
+	assert.Error(t, err)
+}
+
+func TestSetupFileOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "operator.log")
+	logger := logrus.New()
+	require.NoError(t, Configure(logger, Config{Level: "info", Format: FormatJSON}))
+	file, err := SetupFileOutput(logger, FileConfig{Path: path})
+	require.NoError(t, err)
+
+	logger.WithField("name", "lb").Info("reconciled")
+	require.NoError(t, file.Close())
+
+	content := readFile(t, path)
+	assert.Contains(t, content, `"msg":"reconciled"`)
+	assert.Contains(t, content, `"name":"lb"`)
+	assert.Contains(t, content, "file_test.go:")
+	assert.True(t, strings.HasSuffix(content, "\n"))
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
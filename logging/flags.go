@@ -0,0 +1,164 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Environment variables read by FromEnv.
+const (
+	EnvLogLevel           = "LOG_LEVEL"
+	EnvLogFormat          = "LOG_FORMAT"
+	EnvLogCaller          = "LOG_CALLER"
+	EnvLogTimeZone        = "LOG_TIMEZONE"
+	EnvLogTimestampFormat = "LOG_TIMESTAMP_FORMAT"
+)
+
+// Flag names registered by BindFlags.
+const (
+	FlagLogLevel           = "log-level"
+	FlagLogFormat          = "log-format"
+	FlagLogCaller          = "log-caller"
+	FlagLogTimeZone        = "log-timezone"
+	FlagLogTimestampFormat = "log-timestamp-format"
+)
+
+// FromEnv returns the Config described by the LOG_* environment variables, unset variables keep
+// the zero value. The Config is returned even when it's invalid, together with the validation error.
+func FromEnv() (Config, error) {
+	var cfg Config
+	var errs []error
+	cfg.Level = os.Getenv(EnvLogLevel)
+	cfg.Format = os.Getenv(EnvLogFormat)
+	cfg.TimeZone = os.Getenv(EnvLogTimeZone)
+	cfg.TimestampFormat = os.Getenv(EnvLogTimestampFormat)
+	if value, ok := os.LookupEnv(EnvLogCaller); ok && value != "" {
+		caller, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: must be a boolean", EnvLogCaller, value))
+		} else {
+			cfg.DisableCaller = !caller
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// BindFlags registers the --log-* flags on fs, using the current values of c as defaults,
+// so the flags take precedence over FromEnv when it's called first. The values are validated
+// when the flags are parsed.
+func (c *Config) BindFlags(fs *pflag.FlagSet) {
+	fs.Var(&levelValue{cfg: c}, FlagLogLevel, "log level, either a single level such as info, or per component such as loadbalancer=debug,default=info")
+	fs.Var(&formatValue{cfg: c}, FlagLogFormat, fmt.Sprintf("log format, %s or %s", FormatText, FormatJSON))
+	fs.Var(&callerValue{cfg: c}, FlagLogCaller, "report the file:line of the caller")
+	fs.Lookup(FlagLogCaller).NoOptDefVal = "true"
+	fs.StringVar(&c.TimeZone, FlagLogTimeZone, c.TimeZone, "time zone of the timestamps such as UTC, local time zone when empty")
+	fs.StringVar(&c.TimestampFormat, FlagLogTimestampFormat, c.TimestampFormat, "time layout of the timestamps")
+}
+
+// Validate reports every invalid value of c.
+func (c Config) Validate() error {
+	var errs []error
+	if _, err := ParseComponentLevels(c.Level); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log level: %w", err))
+	}
+	if err := validateFormat(c.Format); err != nil {
+		errs = append(errs, err)
+	}
+	if c.TimeZone != "" {
+		if _, err := time.LoadLocation(c.TimeZone); err != nil {
+			errs = append(errs, fmt.Errorf("invalid time zone %q: %w", c.TimeZone, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateFormat(format string) error {
+	switch format {
+	case "", FormatText, FormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid log format %q, must be %q or %q", format, FormatText, FormatJSON)
+	}
+}
+
+var _ pflag.Value = &levelValue{}
+
+type levelValue struct {
+	cfg *Config
+}
+
+func (v *levelValue) String() string {
+	if v.cfg == nil || v.cfg.Level == "" {
+		return "info"
+	}
+	return v.cfg.Level
+}
+
+func (v *levelValue) Set(value string) error {
+	if _, err := ParseComponentLevels(value); err != nil {
+		return err
+	}
+	v.cfg.Level = value
+	return nil
+}
+
+func (v *levelValue) Type() string {
+	return "string"
+}
+
+var _ pflag.Value = &formatValue{}
+
+type formatValue struct {
+	cfg *Config
+}
+
+func (v *formatValue) String() string {
+	if v.cfg == nil || v.cfg.Format == "" {
+		return FormatText
+	}
+	return v.cfg.Format
+}
+
+func (v *formatValue) Set(value string) error {
+	if err := validateFormat(value); err != nil {
+		return err
+	}
+	v.cfg.Format = value
+	return nil
+}
+
+func (v *formatValue) Type() string {
+	return "string"
+}
+
+var _ pflag.Value = &callerValue{}
+
+// callerValue exposes the inverse of Config.DisableCaller as a boolean flag.
+type callerValue struct {
+	cfg *Config
+}
+
+func (v *callerValue) String() string {
+	return strconv.FormatBool(v.cfg == nil || !v.cfg.DisableCaller)
+}
+
+func (v *callerValue) Set(value string) error {
+	caller, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.New("must be a boolean")
+	}
+	v.cfg.DisableCaller = !caller
+	return nil
+}
+
+func (v *callerValue) Type() string {
+	return "bool"
+}
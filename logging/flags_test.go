@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(EnvLogLevel, "loadbalancer=debug,default=warn")
+	t.Setenv(EnvLogFormat, FormatJSON)
+	t.Setenv(EnvLogCaller, "false")
+	t.Setenv(EnvLogTimeZone, "UTC")
+
+	cfg, err := FromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		Level:         "loadbalancer=debug,default=warn",
+		Format:        FormatJSON,
+		DisableCaller: true,
+		TimeZone:      "UTC",
+	}, cfg)
+}
+
+func TestFromEnvInvalid(t *testing.T) {
+	t.Setenv(EnvLogLevel, "inof")
+	t.Setenv(EnvLogFormat, "xml")
+	t.Setenv(EnvLogCaller, "maybe")
+
+	_, err := FromEnv()
+	require.Error(t, err)
+	assert.ErrorContains(t, err, `invalid log level`)
+	assert.ErrorContains(t, err, `"inof"`)
+	assert.ErrorContains(t, err, `invalid log format "xml"`)
+	assert.ErrorContains(t, err, `invalid LOG_CALLER "maybe"`)
+}
+
+func TestBindFlags(t *testing.T) {
+	cfg := Config{Level: "warn"}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	cfg.BindFlags(fs)
+
+	assert.Equal(t, "warn", fs.Lookup(FlagLogLevel).DefValue)
+	assert.Equal(t, "true", fs.Lookup(FlagLogCaller).DefValue)
+
+	require.NoError(t, fs.Parse([]string{"--log-level=notify=error,default=debug", "--log-format", "json", "--log-caller=false"}))
+	assert.Equal(t, "notify=error,default=debug", cfg.Level)
+	assert.Equal(t, FormatJSON, cfg.Format)
+	assert.True(t, cfg.DisableCaller)
+	assert.NoError(t, cfg.Validate())
+
+	require.NoError(t, fs.Parse([]string{"--log-caller"}))
+	assert.False(t, cfg.DisableCaller)
+}
+
+func TestBindFlagsInvalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"--log-level=inof"},
+		{"--log-format=xml"},
+		{"--log-caller=maybe"},
+	} {
+		cfg := Config{}
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		fs.SetOutput(&discard{})
+		cfg.BindFlags(fs)
+		assert.Error(t, fs.Parse(args), args)
+	}
+}
+
+func TestValidateTimeZone(t *testing.T) {
+	assert.ErrorContains(t, Config{TimeZone: "Mars/Olympus"}.Validate(), "invalid time zone")
+	assert.NoError(t, Config{}.Validate())
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) {
+	return len(p), nil
+}
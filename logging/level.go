@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LevelHandlerPath is the conventional path to mount LevelHandler on, e.g. with
+// mgr.AddMetricsServerExtraHandler(logging.LevelHandlerPath, logging.LevelHandler()).
+const LevelHandlerPath = "/debug/loglevel"
+
+type levelPayload struct {
+	Level string `json:"level"`
+}
+
+// SetLevel changes the level of the global logrus logger at runtime, which is the default level
+// when component levels are configured.
+func SetLevel(levelStr string) error {
+	level, err := logrus.ParseLevel(strings.TrimSpace(levelStr))
+	if err != nil {
+		return err
+	}
+	if old := logrus.GetLevel(); old != level {
+		setDefaultLevel(logrus.StandardLogger(), level)
+		logrus.Infof("log level changed from %s to %s", old, level)
+	}
+	return nil
+}
+
+// LevelHandler returns a http.Handler exposing the level of the global logrus logger.
+// GET returns the current level as {"level":"info"}.
+// PUT changes it, the level is read from the "level" query parameter, a JSON body {"level":"debug"}
+// or a plain text body "debug".
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			levelStr, err := levelFromRequest(r)
+			if err == nil {
+				err = SetLevel(levelStr)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(levelPayload{Level: logrus.GetLevel().String()})
+	})
+}
+
+func levelFromRequest(r *http.Request) (string, error) {
+	if level := r.URL.Query().Get("level"); level != "" {
+		return level, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	body = bytes.TrimSpace(body)
+	if bytes.HasPrefix(body, []byte("{")) {
+		var payload levelPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return "", err
+		}
+		return payload.Level, nil
+	}
+	return string(body), nil
+}
+
+// WatchLevelFile sets the level of the global logrus logger from the content of the file at path,
+// then polls it every interval and applies any change until ctx is done.
+// It's meant for a ConfigMap key mounted as a file, which kubelet updates in place without restarting the pod.
+// A missing file or an invalid level is logged and the current level is kept.
+// It returns an error without watching when interval is not positive, and nil once ctx is done.
+func WatchLevelFile(ctx context.Context, path string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid log level file poll interval %s, must be positive", interval)
+	}
+
+	var last string
+	reload := func() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			if last != "" || !os.IsNotExist(err) {
+				logrus.Warnf("failed to read log level file %s: %v", path, err)
+			}
+			last = ""
+			return
+		}
+		levelStr := strings.TrimSpace(string(content))
+		if levelStr == last {
+			return
+		}
+		last = levelStr
+		if err := SetLevel(levelStr); err != nil {
+			logrus.Warnf("invalid log level in file %s: %v", path, err)
+		}
+	}
+
+	reload()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			reload()
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func restoreLevel(t *testing.T) {
+	old := logrus.GetLevel()
+	t.Cleanup(func() { logrus.SetLevel(old) })
+}
+
+func TestLevelHandler(t *testing.T) {
+	restoreLevel(t)
+	logrus.SetLevel(logrus.InfoLevel)
+	handler := LevelHandler()
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantLevel  logrus.Level
+	}{
+		{"get", http.MethodGet, LevelHandlerPath, "", http.StatusOK, logrus.InfoLevel},
+		{"put plain text", http.MethodPut, LevelHandlerPath, "debug\n", http.StatusOK, logrus.DebugLevel},
+		{"put json", http.MethodPut, LevelHandlerPath, `{"level":"warn"}`, http.StatusOK, logrus.WarnLevel},
+		{"put query", http.MethodPut, LevelHandlerPath + "?level=error", "", http.StatusOK, logrus.ErrorLevel},
+		{"put invalid", http.MethodPut, LevelHandlerPath, "verbose", http.StatusBadRequest, logrus.ErrorLevel},
+		{"post", http.MethodPost, LevelHandlerPath, "info", http.StatusMethodNotAllowed, logrus.ErrorLevel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantLevel, logrus.GetLevel())
+			if tt.wantStatus == http.StatusOK {
+				assert.JSONEq(t, `{"level":"`+tt.wantLevel.String()+`"}`, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWatchLevelFile(t *testing.T) {
+	restoreLevel(t)
+	logrus.SetLevel(logrus.InfoLevel)
+	hooks := logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	t.Cleanup(func() { logrus.StandardLogger().ReplaceHooks(hooks) })
+	hook := test.NewGlobal()
+	path := filepath.Join(t.TempDir(), "level")
+	require.NoError(t, os.WriteFile(path, []byte("debug\n"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, WatchLevelFile(ctx, path, 5*time.Millisecond))
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return logrus.GetLevel() == logrus.DebugLevel }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte("verbose"), 0o644))
+	assert.Eventually(t, func() bool {
+		entry := hook.LastEntry()
+		return entry != nil && strings.HasPrefix(entry.Message, "invalid log level in file")
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, logrus.DebugLevel, logrus.GetLevel(), "invalid level must be ignored")
+
+	require.NoError(t, os.WriteFile(path, []byte("warn"), 0o644))
+	assert.Eventually(t, func() bool { return logrus.GetLevel() == logrus.WarnLevel }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestWatchLevelFileInvalidInterval(t *testing.T) {
+	assert.Error(t, WatchLevelFile(context.Background(), "level", 0))
+}
+
+func TestTextLayoutFollowsLevel(t *testing.T) {
+	logger := logrus.New()
+	var out strings.Builder
+	logger.SetOutput(&out)
+	require.NoError(t, Configure(logger, Config{Level: "info", DisableCaller: true}))
+
+	logger.Info("at info")
+	assert.Contains(t, out.String(), "time=")
+
+	out.Reset()
+	logger.SetLevel(logrus.DebugLevel)
+	logger.Info("at debug")
+	assert.NotContains(t, out.String(), "time=")
+}
@@ -17,42 +17,199 @@ limitations under the License.
 package logging
 
 import (
+	"fmt"
 	"path"
 	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config describes how the logger formats its output.
+// The zero value gives the same output as SetupLogger("info").
+type Config struct {
+	// Level is either a single level such as "info", or a per component spec parsed by
+	// ParseComponentLevels such as "loadbalancer=debug,default=info". Info is used when empty.
+	Level string
+	// Format is either FormatText (default) or FormatJSON.
+	Format string
+	// DisableCaller turns off the file:line caller reporting.
+	DisableCaller bool
+	// TimestampFormat is a time layout, time.RFC3339Nano is used for JSON when empty.
+	TimestampFormat string
+	// TimeZone is an IANA time zone name such as "Asia/Ho_Chi_Minh" or "UTC", the local time zone is used when empty.
+	TimeZone string
+	// FieldNames renames the default fields of the JSON output.
+	FieldNames FieldNames
+}
+
+// FieldNames holds the keys of the default fields, empty keys keep the logrus defaults
+// (time, level, msg and file).
+type FieldNames struct {
+	Time    string
+	Level   string
+	Message string
+	Caller  string
+}
+
 // SetupLogger configures the global logrus logger with the specified log level.
 // For debug level, timestamps are disabled and a simplified format is used.
 // For other levels, timestamps are enabled with file:line caller information.
+// An invalid level falls back to info with a warning, and the parse error is returned.
+// Use FromEnv or Config.BindFlags with SetupLoggerWithConfig for a strict validation.
 func SetupLogger(levelStr string) error {
 	level, err := logrus.ParseLevel(levelStr)
 	if err != nil {
 		level = logrus.InfoLevel
 	}
 
-	logrus.SetLevel(level)
-	logrus.SetReportCaller(true)
+	if setupErr := SetupLoggerWithConfig(Config{Level: level.String()}); setupErr != nil {
+		return setupErr
+	}
+	if err != nil {
+		logrus.Warnf("invalid log level %q, falling back to %s: %v", levelStr, level, err)
+	}
+	return err
+}
+
+// SetupLoggerWithConfig configures the global logrus logger from cfg.
+func SetupLoggerWithConfig(cfg Config) error {
+	return Configure(logrus.StandardLogger(), cfg)
+}
+
+// Configure applies cfg to logger, it's left untouched when cfg is invalid.
+func Configure(logger *logrus.Logger, cfg Config) error {
+	levels, err := ParseComponentLevels(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	// the text layout follows the level of logger, so SetLevel switches it between debug and the others
+	formatter, err := newFormatter(cfg, func() bool { return logger.GetLevel() == logrus.DebugLevel })
+	if err != nil {
+		return err
+	}
+
+	logger.SetReportCaller(!cfg.DisableCaller)
+	logger.SetFormatter(formatter)
+	SetComponentLevels(logger, levels)
+	return nil
+}
+
+// NewFormatter builds the formatter described by cfg, level is needed since the text format
+// is more compact for debug level.
+func NewFormatter(cfg Config, level logrus.Level) (logrus.Formatter, error) {
+	debug := level == logrus.DebugLevel
+	return newFormatter(cfg, func() bool { return debug })
+}
+
+// newFormatter builds the formatter described by cfg, the text format uses the debug layout while isDebug returns true.
+func newFormatter(cfg Config, isDebug func() bool) (logrus.Formatter, error) {
+	var location *time.Location
+	if cfg.TimeZone != "" {
+		var err error
+		location, err = time.LoadLocation(cfg.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", cfg.TimeZone, err)
+		}
+	}
+
+	var formatter logrus.Formatter
+	switch cfg.Format {
+	case "", FormatText:
+		formatter = &textFormatter{
+			debug:   newTextFormatter(cfg, logrus.DebugLevel),
+			other:   newTextFormatter(cfg, logrus.InfoLevel),
+			isDebug: isDebug,
+		}
+	case FormatJSON:
+		formatter = newJSONFormatter(cfg)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be %q or %q", cfg.Format, FormatText, FormatJSON)
+	}
 
+	if location != nil {
+		formatter = &locationFormatter{Formatter: formatter, location: location}
+	}
+	return formatter, nil
+}
+
+// textFormatter switches between the text layouts of the debug level and of the other levels.
+type textFormatter struct {
+	debug   *logrus.TextFormatter
+	other   *logrus.TextFormatter
+	isDebug func() bool
+}
+
+func (f *textFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if f.isDebug() {
+		return f.debug.Format(entry)
+	}
+	return f.other.Format(entry)
+}
+
+func newTextFormatter(cfg Config, level logrus.Level) *logrus.TextFormatter {
 	if level == logrus.DebugLevel {
-		logrus.SetFormatter(&logrus.TextFormatter{
+		return &logrus.TextFormatter{
 			DisableTimestamp: true,
 			CallerPrettyfier: func(frame *runtime.Frame) (function string, file string) {
 				fileName := " " + path.Base(frame.File) + ":" + strconv.Itoa(frame.Line) + " |"
 				return "", fileName
 			},
-		})
-	} else {
-		logrus.SetFormatter(&logrus.TextFormatter{
-			DisableTimestamp: false,
-			CallerPrettyfier: func(frame *runtime.Frame) (function string, file string) {
-				fileName := path.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
-				return "", fileName
-			},
-		})
+		}
+	}
+	return &logrus.TextFormatter{
+		DisableTimestamp: false,
+		FullTimestamp:    cfg.TimestampFormat != "",
+		TimestampFormat:  cfg.TimestampFormat,
+		CallerPrettyfier: callerPrettyfier,
+	}
+}
+
+func newJSONFormatter(cfg Config) *logrus.JSONFormatter {
+	timestampFormat := cfg.TimestampFormat
+	if timestampFormat == "" {
+		timestampFormat = time.RFC3339Nano
+	}
+	fieldMap := logrus.FieldMap{}
+	if cfg.FieldNames.Time != "" {
+		fieldMap[logrus.FieldKeyTime] = cfg.FieldNames.Time
+	}
+	if cfg.FieldNames.Level != "" {
+		fieldMap[logrus.FieldKeyLevel] = cfg.FieldNames.Level
+	}
+	if cfg.FieldNames.Message != "" {
+		fieldMap[logrus.FieldKeyMsg] = cfg.FieldNames.Message
+	}
+	if cfg.FieldNames.Caller != "" {
+		fieldMap[logrus.FieldKeyFile] = cfg.FieldNames.Caller
+	}
+	return &logrus.JSONFormatter{
+		TimestampFormat:  timestampFormat,
+		FieldMap:         fieldMap,
+		CallerPrettyfier: callerPrettyfier,
 	}
+}
 
-	return err
+// callerPrettyfier reports the caller as file:line without the function name.
+func callerPrettyfier(frame *runtime.Frame) (function string, file string) {
+	fileName := path.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+	return "", fileName
+}
+
+// locationFormatter converts the entry time to a time zone before formatting it.
+type locationFormatter struct {
+	logrus.Formatter
+	location *time.Location
+}
+
+func (f *locationFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	entry.Time = entry.Time.In(f.location)
+	return f.Formatter.Format(entry)
 }
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+
+	err := Configure(logger, Config{
+		Level:    "debug",
+		Format:   FormatJSON,
+		TimeZone: "Asia/Ho_Chi_Minh",
+		FieldNames: FieldNames{
+			Time:    "ts",
+			Level:   "level",
+			Message: "msg",
+			Caller:  "caller",
+		},
+	})
+	require.NoError(t, err)
+	logger.WithField("id", "1234").Debug("hello")
+
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "hello", out["msg"])
+	assert.Equal(t, "debug", out["level"])
+	assert.Equal(t, "1234", out["id"])
+	assert.Regexp(t, `^logging_test\.go:\d+$`, out["caller"])
+	assert.NotContains(t, out, "func")
+
+	ts, err := time.Parse(time.RFC3339Nano, out["ts"].(string))
+	require.NoError(t, err)
+	_, offset := ts.Zone()
+	assert.Equal(t, 7*60*60, offset)
+}
+
+func TestConfigureDisableCaller(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+
+	require.NoError(t, Configure(logger, Config{Format: FormatJSON, DisableCaller: true}))
+	logger.Info("hello")
+
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.NotContains(t, out, logrus.FieldKeyFile)
+	assert.Equal(t, logrus.InfoLevel, logger.GetLevel())
+}
+
+func TestConfigureInvalid(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	assert.Error(t, Configure(logger, Config{Level: "verbose"}))
+	assert.Error(t, Configure(logger, Config{Format: "xml"}))
+	assert.Error(t, Configure(logger, Config{TimeZone: "Mars/Olympus"}))
+	assert.Equal(t, logrus.WarnLevel, logger.GetLevel(), "invalid config must not be applied")
+}
+
+func TestSetupLoggerFallback(t *testing.T) {
+	oldLevel, oldFormatter, oldOut := logrus.GetLevel(), logrus.StandardLogger().Formatter, logrus.StandardLogger().Out
+	defer func() {
+		logrus.SetLevel(oldLevel)
+		logrus.SetFormatter(oldFormatter)
+		logrus.SetReportCaller(false)
+		logrus.SetOutput(oldOut)
+	}()
+
+	assert.Error(t, SetupLogger("verbose"))
+	assert.Equal(t, logrus.InfoLevel, logrus.GetLevel())
+
+	assert.NoError(t, SetupLogger("debug"))
+	assert.Equal(t, logrus.DebugLevel, logrus.GetLevel())
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	logrus.Debug("hello")
+	assert.NotContains(t, buf.String(), "time=", "debug layout has no timestamp")
+}
@@ -0,0 +1,243 @@
+// Package loggingtest provides helpers to assert on logrus output in tests.
+package loggingtest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Entry is a log entry recorded by a Capture.
+type Entry struct {
+	Level   logrus.Level
+	Message string
+	Fields  logrus.Fields
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("%s %q %v", e.Level, e.Message, e.Fields)
+}
+
+var _ logrus.Hook = &Capture{}
+
+// Capture is a logrus hook recording every entry of a logger.
+type Capture struct {
+	mutex   sync.Mutex
+	entries []Entry
+}
+
+var (
+	// globalMutex serializes the tests using the global logger, even when they run in parallel
+	globalMutex sync.Mutex
+
+	// stateMutex guards the fields below
+	stateMutex sync.Mutex
+	// owner is the name of the test holding globalMutex, empty when it's free
+	owner string
+	// global is the Capture of the global logger, nil when it's not captured
+	global *Capture
+)
+
+// LockGlobal gives the test an exclusive use of the global logrus logger until its end, for the tests
+// changing it without CaptureGlobal: tests calling LockGlobal or CaptureGlobal run one at a time.
+// It returns immediately when the test or one of its parents already holds it.
+func LockGlobal(t testing.TB) {
+	t.Helper()
+	lockGlobal(t)
+}
+
+// lockGlobal returns false when the test or one of its parents already holds globalMutex.
+func lockGlobal(t testing.TB) bool {
+	if ownedBy(t) {
+		return false
+	}
+	globalMutex.Lock()
+	stateMutex.Lock()
+	owner = t.Name()
+	stateMutex.Unlock()
+
+	t.Cleanup(func() {
+		stateMutex.Lock()
+		owner = ""
+		stateMutex.Unlock()
+		globalMutex.Unlock()
+	})
+	return true
+}
+
+// ownedBy reports whether t or one of its parents holds globalMutex, subtests are named "<parent>/<name>".
+func ownedBy(t testing.TB) bool {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	return owner != "" && (t.Name() == owner || strings.HasPrefix(t.Name(), owner+"/"))
+}
+
+// CaptureGlobal redirects the global logrus logger to a new Capture until the end of the test:
+// every level is recorded, nothing is written, and the hooks already installed are not fired.
+// The previous state of the logger is restored by t.Cleanup. It holds the global logger like
+// LockGlobal, so the tests changing the global logger otherwise must call LockGlobal to not run
+// meanwhile. When the test or one of its parents already captured the global logger, the same
+// Capture is returned.
+func CaptureGlobal(t testing.TB) *Capture {
+	t.Helper()
+	if !lockGlobal(t) {
+		stateMutex.Lock()
+		capture := global
+		stateMutex.Unlock()
+		if capture != nil {
+			return capture
+		}
+	}
+
+	logger := logrus.StandardLogger()
+	capture := &Capture{}
+	restore := redirect(logger, capture)
+	stateMutex.Lock()
+	global = capture
+	stateMutex.Unlock()
+
+	// registered after the cleanup of lockGlobal, so it runs first
+	t.Cleanup(func() {
+		stateMutex.Lock()
+		global = nil
+		stateMutex.Unlock()
+		restore()
+	})
+	return capture
+}
+
+// NewLogger returns a new logger recording to a Capture, for code taking a logger or an entry.
+func NewLogger() (*logrus.Logger, *Capture) {
+	logger := logrus.New()
+	capture := &Capture{}
+	redirect(logger, capture)
+	return logger, capture
+}
+
+// redirect points logger to capture and returns a function restoring its previous state.
+func redirect(logger *logrus.Logger, capture *Capture) func() {
+	out, formatter, level, reportCaller := logger.Out, logger.Formatter, logger.GetLevel(), logger.ReportCaller
+	hooks := make(logrus.LevelHooks)
+	for _, level := range logrus.AllLevels {
+		hooks[level] = []logrus.Hook{capture}
+	}
+	oldHooks := logger.ReplaceHooks(hooks)
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(logrus.TraceLevel)
+
+	return func() {
+		logger.ReplaceHooks(oldHooks)
+		logger.SetOutput(out)
+		logger.SetFormatter(formatter)
+		logger.SetLevel(level)
+		logger.SetReportCaller(reportCaller)
+	}
+}
+
+func (c *Capture) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (c *Capture) Fire(entry *logrus.Entry) error {
+	fields := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		fields[key] = value
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = append(c.entries, Entry{
+		Level:   entry.Level,
+		Message: entry.Message,
+		Fields:  fields,
+	})
+	return nil
+}
+
+// Entries returns a copy of the recorded entries.
+func (c *Capture) Entries() []Entry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]Entry(nil), c.entries...)
+}
+
+// Reset forgets the recorded entries.
+func (c *Capture) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = nil
+}
+
+// Find returns the entries of level whose message contains substring and which have all fields.
+// Field values are compared by their fmt.Sprint representation, so an error matches its message.
+func (c *Capture) Find(level logrus.Level, substring string, fields logrus.Fields) []Entry {
+	var result []Entry
+	for _, entry := range c.Entries() {
+		if entry.Level == level && strings.Contains(entry.Message, substring) && hasFields(entry, fields) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// RequireLogged fails the test immediately when no entry matches, see Find.
+func (c *Capture) RequireLogged(t testing.TB, level logrus.Level, substring string, fields logrus.Fields) {
+	t.Helper()
+	if len(c.Find(level, substring, fields)) == 0 {
+		t.Fatalf("no %s entry containing %q with fields %v, got:\n%s", level, substring, fields, c.dump())
+	}
+}
+
+// RequireNotLogged fails the test immediately when an entry matches, see Find.
+func (c *Capture) RequireNotLogged(t testing.TB, level logrus.Level, substring string, fields logrus.Fields) {
+	t.Helper()
+	if found := c.Find(level, substring, fields); len(found) > 0 {
+		t.Fatalf("unexpected %s entry containing %q with fields %v: %s", level, substring, fields, found[0])
+	}
+}
+
+// RequireLogged asserts on the global logger captured by CaptureGlobal.
+func RequireLogged(t testing.TB, level logrus.Level, substring string, fields logrus.Fields) {
+	t.Helper()
+	globalCapture(t).RequireLogged(t, level, substring, fields)
+}
+
+// RequireNotLogged asserts on the global logger captured by CaptureGlobal.
+func RequireNotLogged(t testing.TB, level logrus.Level, substring string, fields logrus.Fields) {
+	t.Helper()
+	globalCapture(t).RequireNotLogged(t, level, substring, fields)
+}
+
+func globalCapture(t testing.TB) *Capture {
+	t.Helper()
+	stateMutex.Lock()
+	capture := global
+	stateMutex.Unlock()
+	if capture == nil {
+		t.Fatal("the global logger is not captured, call CaptureGlobal first")
+	}
+	return capture
+}
+
+func hasFields(entry Entry, fields logrus.Fields) bool {
+	for key, want := range fields {
+		got, ok := entry.Fields[key]
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Capture) dump() string {
+	var builder strings.Builder
+	for _, entry := range c.Entries() {
+		builder.WriteString("  ")
+		builder.WriteString(entry.String())
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
@@ -0,0 +1,94 @@
+package loggingtest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingHook struct {
+	fired int
+}
+
+func (h *countingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *countingHook) Fire(*logrus.Entry) error {
+	h.fired++
+	return nil
+}
+
+func TestCaptureGlobalRestoresLogger(t *testing.T) {
+	LockGlobal(t)
+	var buf bytes.Buffer
+	hook := &countingHook{}
+	logger := logrus.StandardLogger()
+	oldOut, oldLevel := logger.Out, logger.GetLevel()
+	logger.SetOutput(&buf)
+	logger.SetLevel(logrus.WarnLevel)
+	logger.AddHook(hook)
+	defer func() {
+		logger.SetOutput(oldOut)
+		logger.SetLevel(oldLevel)
+		logger.ReplaceHooks(make(logrus.LevelHooks))
+	}()
+
+	t.Run("captured", func(t *testing.T) {
+		CaptureGlobal(t)
+		logrus.WithFields(logrus.Fields{"id": "1234", "count": 3}).Debug("requeue after duration: 3s")
+		logrus.WithError(errors.New("boom")).Error("reconcile failed")
+
+		RequireLogged(t, logrus.DebugLevel, "requeue after", logrus.Fields{"id": "1234", "count": "3"})
+		RequireLogged(t, logrus.ErrorLevel, "failed", logrus.Fields{logrus.ErrorKey: "boom"})
+		RequireNotLogged(t, logrus.InfoLevel, "requeue", nil)
+	})
+
+	assert.Empty(t, buf.String(), "captured entries must not be written")
+	assert.Equal(t, 0, hook.fired, "installed hooks must not be fired")
+	assert.Equal(t, logrus.WarnLevel, logger.GetLevel())
+
+	logrus.Warn("after capture")
+	assert.Contains(t, buf.String(), "after capture")
+	assert.Equal(t, 1, hook.fired)
+}
+
+func TestCaptureGlobalParallel(t *testing.T) {
+	for _, name := range []string{"a", "b", "c"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			capture := CaptureGlobal(t)
+			logrus.Info(name)
+			entries := capture.Entries()
+			if assert.Len(t, entries, 1) {
+				assert.Equal(t, name, entries[0].Message)
+			}
+		})
+	}
+}
+
+func TestCaptureGlobalReentrant(t *testing.T) {
+	capture := CaptureGlobal(t)
+	assert.Same(t, capture, CaptureGlobal(t), "a second call must not deadlock")
+
+	t.Run("subtest", func(t *testing.T) {
+		assert.Same(t, capture, CaptureGlobal(t), "a subtest must not deadlock")
+		logrus.Info("from subtest")
+	})
+	RequireLogged(t, logrus.InfoLevel, "from subtest", nil)
+}
+
+func TestNewLogger(t *testing.T) {
+	logger, capture := NewLogger()
+	logger.WithField("name", "lb").Trace("trace message")
+
+	assert.Len(t, capture.Find(logrus.TraceLevel, "trace", logrus.Fields{"name": "lb"}), 1)
+	assert.Empty(t, capture.Find(logrus.TraceLevel, "trace", logrus.Fields{"name": "pool"}))
+	assert.Empty(t, capture.Find(logrus.InfoLevel, "trace", nil))
+
+	capture.Reset()
+	assert.Empty(t, capture.Entries())
+}
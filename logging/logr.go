@@ -0,0 +1,202 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/go-logr/logr"
+	"github.com/sirupsen/logrus"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// loggerNameField holds the name given by logr.Logger.WithName, e.g. "controller-runtime.metrics".
+const loggerNameField = "logger"
+
+type callerKey struct{}
+
+var _ logr.LogSink = &logrusSink{}
+var _ logr.CallDepthLogSink = &logrusSink{}
+
+// logrusSink is a logr.LogSink writing through a logrus logger, so controller-runtime and client-go
+// share the output of the operator.
+type logrusSink struct {
+	logger    *logrus.Logger
+	name      string
+	fields    logrus.Fields
+	callDepth int
+}
+
+// NewLogSink returns a logr.LogSink backed by logger. logr V-levels are mapped with VerbosityToLevel.
+// Use it together with CallerHook so the reported caller is the code calling logr, not the sink.
+func NewLogSink(logger *logrus.Logger) logr.LogSink {
+	return &logrusSink{
+		logger: logger,
+		fields: logrus.Fields{},
+	}
+}
+
+// NewLogr returns a logr.Logger backed by logger.
+func NewLogr(logger *logrus.Logger) logr.Logger {
+	return logr.New(NewLogSink(logger))
+}
+
+// SetupLogr routes the logs of controller-runtime and klog (client-go) through logger,
+// and installs CallerHook on it unless it's already installed, so it can be called again.
+func SetupLogr(logger *logrus.Logger) {
+	if !hasCallerHook(logger) {
+		logger.AddHook(&CallerHook{})
+	}
+	log := NewLogr(logger)
+	ctrl.SetLogger(log)
+	klog.SetLogger(log)
+}
+
+func hasCallerHook(logger *logrus.Logger) bool {
+	for _, hook := range logger.Hooks[logrus.InfoLevel] {
+		if _, ok := hook.(*CallerHook); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupAllLoggers configures the global logrus logger from cfg and routes controller-runtime and
+// klog through it, giving the whole binary the same output.
+func SetupAllLoggers(cfg Config) error {
+	if err := SetupLoggerWithConfig(cfg); err != nil {
+		return err
+	}
+	SetupLogr(logrus.StandardLogger())
+	return nil
+}
+
+// VerbosityToLevel maps a logr V-level to a logrus level: V(0) is info, V(1) is debug
+// and anything more verbose is trace.
+func VerbosityToLevel(verbosity int) logrus.Level {
+	switch {
+	case verbosity <= 0:
+		return logrus.InfoLevel
+	case verbosity == 1:
+		return logrus.DebugLevel
+	default:
+		return logrus.TraceLevel
+	}
+}
+
+func (s *logrusSink) Init(info logr.RuntimeInfo) {
+	s.callDepth = info.CallDepth
+}
+
+func (s *logrusSink) Enabled(level int) bool {
+	return ComponentLogger(s.logger, s.name).IsLevelEnabled(VerbosityToLevel(level))
+}
+
+func (s *logrusSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.entry(keysAndValues).Log(VerbosityToLevel(level), msg)
+}
+
+func (s *logrusSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	entry := s.entry(keysAndValues)
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+	entry.Error(msg)
+}
+
+func (s *logrusSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	clone := s.clone()
+	addKeysAndValues(clone.fields, keysAndValues)
+	return clone
+}
+
+func (s *logrusSink) WithName(name string) logr.LogSink {
+	clone := s.clone()
+	if clone.name != "" {
+		name = clone.name + "." + name
+	}
+	clone.name = name
+	return clone
+}
+
+func (s *logrusSink) WithCallDepth(depth int) logr.LogSink {
+	clone := s.clone()
+	clone.callDepth += depth
+	return clone
+}
+
+func (s *logrusSink) clone() *logrusSink {
+	fields := make(logrus.Fields, len(s.fields))
+	for k, v := range s.fields {
+		fields[k] = v
+	}
+	return &logrusSink{
+		logger:    s.logger,
+		name:      s.name,
+		fields:    fields,
+		callDepth: s.callDepth,
+	}
+}
+
+// entry must be called directly by Info or Error, the caller frame is computed from there.
+func (s *logrusSink) entry(keysAndValues []interface{}) *logrus.Entry {
+	fields := make(logrus.Fields, len(s.fields)+len(keysAndValues)/2+1)
+	for k, v := range s.fields {
+		fields[k] = v
+	}
+	addKeysAndValues(fields, keysAndValues)
+	if s.name != "" {
+		fields[loggerNameField] = s.name
+	}
+
+	logger := ComponentLogger(s.logger, s.name)
+	entry := logger.WithFields(fields)
+	if logger.ReportCaller {
+		// skip entry, Info/Error and then the logr.Logger frames
+		if pc, file, line, ok := runtime.Caller(2 + s.callDepth); ok {
+			frame := &runtime.Frame{PC: pc, File: file, Line: line}
+			if fn := runtime.FuncForPC(pc); fn != nil {
+				frame.Function = fn.Name()
+			}
+			entry = entry.WithContext(context.WithValue(context.Background(), callerKey{}, frame))
+		}
+	}
+	return entry
+}
+
+func addKeysAndValues(fields logrus.Fields, keysAndValues []interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		if i+1 >= len(keysAndValues) {
+			fields[key] = "(MISSING)"
+			break
+		}
+		value := keysAndValues[i+1]
+		if marshaler, ok := value.(logr.Marshaler); ok {
+			value = marshaler.MarshalLog()
+		}
+		fields[key] = value
+	}
+}
+
+// CallerHook replaces the caller found by logrus, which is always the logr sink,
+// with the frame of the code calling logr.
+type CallerHook struct{}
+
+func (h *CallerHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *CallerHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if frame, ok := entry.Context.Value(callerKey{}).(*runtime.Frame); ok {
+		entry.Caller = frame
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newJSONLogger(t *testing.T, level string) (*logrus.Logger, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	require.NoError(t, Configure(logger, Config{Level: level, Format: FormatJSON}))
+	logger.AddHook(&CallerHook{})
+	return logger, &buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var out map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &out))
+		lines = append(lines, out)
+	}
+	return lines
+}
+
+func TestLogrSink(t *testing.T) {
+	logger, buf := newJSONLogger(t, "debug")
+	log := NewLogr(logger).WithName("controller-runtime").WithName("metrics").WithValues("controller", "loadbalancer")
+
+	log.Info("starting", "workers", 2)
+	log.V(1).Info("debug message")
+	log.V(2).Info("trace message is filtered")
+	log.Error(errors.New("boom"), "reconcile failed", "odd")
+
+	lines := decodeLines(t, buf)
+	require.Len(t, lines, 3)
+
+	assert.Equal(t, "info", lines[0]["level"])
+	assert.Equal(t, "starting", lines[0]["msg"])
+	assert.Equal(t, "controller-runtime.metrics", lines[0][loggerNameField])
+	assert.Equal(t, "loadbalancer", lines[0]["controller"])
+	assert.EqualValues(t, 2, lines[0]["workers"])
+	assert.Regexp(t, `^logr_test\.go:\d+$`, lines[0]["file"])
+
+	assert.Equal(t, "debug", lines[1]["level"])
+	assert.Regexp(t, `^logr_test\.go:\d+$`, lines[1]["file"])
+
+	assert.Equal(t, "error", lines[2]["level"])
+	assert.Equal(t, "boom", lines[2]["error"])
+	assert.Equal(t, "(MISSING)", lines[2]["odd"])
+}
+
+func TestLogrSinkEnabled(t *testing.T) {
+	logger, _ := newJSONLogger(t, "info")
+	log := NewLogr(logger)
+
+	assert.True(t, log.Enabled())
+	assert.False(t, log.V(1).Enabled())
+
+	logger.SetLevel(logrus.TraceLevel)
+	assert.True(t, log.V(5).Enabled())
+}
+
+func TestVerbosityToLevel(t *testing.T) {
+	assert.Equal(t, logrus.InfoLevel, VerbosityToLevel(0))
+	assert.Equal(t, logrus.DebugLevel, VerbosityToLevel(1))
+	assert.Equal(t, logrus.TraceLevel, VerbosityToLevel(4))
+}
+
+func TestSetupLogrIdempotent(t *testing.T) {
+	logger := logrus.New()
+	SetupLogr(logger)
+	SetupLogr(logger)
+	assert.Len(t, logger.Hooks[logrus.InfoLevel], 1)
+}
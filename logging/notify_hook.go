@@ -0,0 +1,257 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/utils/clock"
+
+	"github.com/anngdinh/operator-helper/notify"
+)
+
+// NotifyHookConfig configures a NotifyHook.
+type NotifyHookConfig struct {
+	// MinInterval is the minimum time between two notifications with the same fingerprint,
+	// the entries in between are counted and the count is sent with the next notification.
+	// It's one minute when not positive.
+	MinInterval time.Duration
+	// QueueSize is the number of notifications waiting to be sent, beyond which the new ones are
+	// dropped, 100 when not positive.
+	QueueSize int
+	// Levels are the forwarded levels, error, fatal and panic when empty.
+	Levels []logrus.Level
+	// FingerprintFields are the fields identifying similar entries together with the message,
+	// e.g. "name" to get one notification per reconciled object.
+	FingerprintFields []string
+	// Recent, when set, attaches to the content the last RecentLines entries of the log ID of the entry,
+	// ending with the entry itself whether Recent is fired before or after the NotifyHook.
+	Recent      *RecentLogs
+	RecentLines int
+	// Clock is the real clock when nil.
+	Clock clock.PassiveClock
+}
+
+// Defaults of NotifyHookConfig.
+const (
+	defaultRecentLines       = 50
+	defaultNotifyMinInterval = time.Minute
+	defaultNotifyQueueSize   = 100
+	// fatalSendTimeout bounds the wait for the notification of a fatal or panic entry
+	fatalSendTimeout = 10 * time.Second
+)
+
+// DroppedField holds the number of notifications dropped because the queue was full since the last sent one.
+const DroppedField = "dropped"
+
+type notifyState struct {
+	lastSent   time.Time
+	suppressed int
+}
+
+var _ logrus.Hook = &NotifyHook{}
+
+// NotifyHook is a logrus hook sending the error entries to a notify.Notifier with notify.StatusError.
+// The fields of the entry, including the id and name added by contexts, become the notification fields,
+// and the message becomes its content. The notifications are queued and sent by a goroutine of the hook,
+// so a slow notifier doesn't block the logger. As the process is about to stop on the fatal and panic
+// entries, they are sent with SendSync before Fire returns when the notifier is a notify.SyncNotifier,
+// waiting up to fatalSendTimeout. Otherwise they are queued like the others and may be lost.
+// The entries logged by the notifier about its own failures are not forwarded.
+type NotifyHook struct {
+	notifier notify.Notifier
+	config   NotifyHookConfig
+
+	mutex   sync.Mutex
+	sent    map[string]*notifyState
+	dropped int
+	closed  bool
+
+	queue chan notification
+	done  chan struct{}
+}
+
+type notification struct {
+	fields  map[string]string
+	content string
+}
+
+// NewNotifyHook creates a NotifyHook sending to notifier, install it with logger.AddHook.
+// Call Close on shutdown to send the queued notifications.
+func NewNotifyHook(notifier notify.Notifier, config NotifyHookConfig) *NotifyHook {
+	if len(config.Levels) == 0 {
+		config.Levels = []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+	}
+	if config.Clock == nil {
+		config.Clock = clock.RealClock{}
+	}
+	if config.RecentLines <= 0 {
+		config.RecentLines = defaultRecentLines
+	}
+	if config.MinInterval <= 0 {
+		config.MinInterval = defaultNotifyMinInterval
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultNotifyQueueSize
+	}
+	h := &NotifyHook{
+		notifier: notifier,
+		config:   config,
+		sent:     map[string]*notifyState{},
+		queue:    make(chan notification, config.QueueSize),
+		done:     make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+func (h *NotifyHook) run() {
+	defer close(h.done)
+	for n := range h.queue {
+		h.notifier.Send(notify.StatusError, n.fields, n.content)
+	}
+}
+
+// Close stops forwarding the entries, and returns once the queued notifications are sent.
+func (h *NotifyHook) Close() {
+	h.mutex.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.queue)
+	}
+	h.mutex.Unlock()
+	<-h.done
+}
+
+func (h *NotifyHook) Levels() []logrus.Level {
+	return h.config.Levels
+}
+
+func (h *NotifyHook) Fire(entry *logrus.Entry) error {
+	if entry.Message == notify.SendFailedMessage {
+		return nil
+	}
+	suppressed, ok := h.shouldSend(h.fingerprint(entry))
+	if !ok {
+		return nil
+	}
+
+	fields := make(map[string]string, len(entry.Data)+3)
+	for key, value := range entry.Data {
+		fields[key] = fmt.Sprint(value)
+	}
+	fields["level"] = entry.Level.String()
+	if entry.HasCaller() {
+		fields["caller"] = path.Base(entry.Caller.File) + ":" + strconv.Itoa(entry.Caller.Line)
+	}
+	if suppressed > 0 {
+		fields[SuppressedField] = strconv.Itoa(suppressed)
+	}
+
+	n := notification{fields: fields, content: h.content(entry)}
+	if syncNotifier, ok := h.notifier.(notify.SyncNotifier); ok && entry.Level <= logrus.FatalLevel {
+		ctx, cancel := context.WithTimeout(context.Background(), fatalSendTimeout)
+		defer cancel()
+		// a failure is logged by the notifier
+		_ = syncNotifier.SendSync(ctx, notify.StatusError, n.fields, n.content)
+		return nil
+	}
+	h.enqueue(n)
+	return nil
+}
+
+// enqueue queues n unless the queue is full or the hook is closed, a dropped notification is
+// counted and the count is sent with the next one.
+func (h *NotifyHook) enqueue(n notification) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closed {
+		return
+	}
+	if h.dropped > 0 {
+		n.fields[DroppedField] = strconv.Itoa(h.dropped)
+	}
+	select {
+	case h.queue <- n:
+		h.dropped = 0
+	default:
+		h.dropped++
+	}
+}
+
+func (h *NotifyHook) content(entry *logrus.Entry) string {
+	if h.config.Recent == nil {
+		return entry.Message
+	}
+	id, ok := entry.Data[LogIDField].(string)
+	if !ok || id == "" {
+		return entry.Message
+	}
+	records := h.config.Recent.records(id, h.config.RecentLines)
+	if n := len(records); n > 0 && records[n-1].time.Equal(entry.Time) && records[n-1].message == entry.Message {
+		// Recent was fired first, the entry is already there
+		records = records[:n-1]
+	} else if n == h.config.RecentLines {
+		records = records[1:]
+	}
+	if len(records) == 0 {
+		return entry.Message
+	}
+	records = append(records, newRecentRecord(entry))
+
+	var builder strings.Builder
+	builder.WriteString(entry.Message)
+	builder.WriteString("\n\nRecent logs of ")
+	builder.WriteString(id)
+	builder.WriteString(":\n")
+	for _, record := range records {
+		builder.WriteString(record.entry().String())
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// shouldSend reports whether a notification with fingerprint can be sent now,
+// with the number of entries suppressed since the last one.
+func (h *NotifyHook) shouldSend(fingerprint string) (int, bool) {
+	now := h.config.Clock.Now()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	state, ok := h.sent[fingerprint]
+	if ok && now.Sub(state.lastSent) < h.config.MinInterval {
+		state.suppressed++
+		return 0, false
+	}
+	suppressed := 0
+	if ok {
+		suppressed = state.suppressed
+	}
+	h.sent[fingerprint] = &notifyState{lastSent: now}
+
+	// forget the fingerprints which would be sent anyway, so the map doesn't grow forever
+	for key, state := range h.sent {
+		if state.suppressed == 0 && now.Sub(state.lastSent) >= h.config.MinInterval {
+			delete(h.sent, key)
+		}
+	}
+	return suppressed, true
+}
+
+func (h *NotifyHook) fingerprint(entry *logrus.Entry) string {
+	var builder strings.Builder
+	builder.WriteString(entry.Message)
+	for _, field := range h.config.FingerprintFields {
+		builder.WriteByte(0)
+		if value, ok := entry.Data[field]; ok {
+			builder.WriteString(fmt.Sprint(value))
+		}
+	}
+	return builder.String()
+}
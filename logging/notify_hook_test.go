@@ -0,0 +1,211 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/anngdinh/operator-helper/notify"
+)
+
+type sentNotification struct {
+	status  notify.Status
+	fields  map[string]string
+	content string
+}
+
+type fakeNotifier struct {
+	mutex sync.Mutex
+	sent  []sentNotification
+}
+
+func (n *fakeNotifier) Send(status notify.Status, fields map[string]string, content string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.sent = append(n.sent, sentNotification{status: status, fields: fields, content: content})
+}
+
+// waitSent waits for count notifications to be sent by the goroutine of the hook, and returns them.
+func (n *fakeNotifier) waitSent(t *testing.T, count int) []sentNotification {
+	t.Helper()
+	var sent []sentNotification
+	require.Eventually(t, func() bool {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+		sent = append([]sentNotification(nil), n.sent...)
+		return len(sent) >= count
+	}, time.Second, time.Millisecond)
+	require.Len(t, sent, count)
+	return sent
+}
+
+// blockingNotifier blocks every Send until release is closed, started receives a value for every Send.
+type blockingNotifier struct {
+	fakeNotifier
+	started chan struct{}
+	release chan struct{}
+}
+
+func (n *blockingNotifier) Send(status notify.Status, fields map[string]string, content string) {
+	n.started <- struct{}{}
+	<-n.release
+	n.fakeNotifier.Send(status, fields, content)
+}
+
+// syncNotifier records the notifications sent with SendSync apart.
+type syncNotifier struct {
+	fakeNotifier
+	sentSync []sentNotification
+}
+
+func (n *syncNotifier) SendSync(ctx context.Context, status notify.Status, fields map[string]string, content string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.sentSync = append(n.sentSync, sentNotification{status: status, fields: fields, content: content})
+	return nil
+}
+
+func TestNotifyHook(t *testing.T) {
+	notifier := &fakeNotifier{}
+	fakeClock := clocktesting.NewFakePassiveClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	require.NoError(t, Configure(logger, Config{}))
+	hook := NewNotifyHook(notifier, NotifyHookConfig{
+		MinInterval:       time.Minute,
+		FingerprintFields: []string{"name"},
+		Clock:             fakeClock,
+	})
+	defer hook.Close()
+	logger.AddHook(hook)
+
+	log := logger.WithFields(logrus.Fields{"id": "1234", "name": "loadbalancer"})
+	log.Info("not forwarded")
+	log.Warn("not forwarded")
+	for i := 0; i < 5; i++ {
+		log.Error("failed to delete listener")
+	}
+	logger.WithField("name", "pool").Error("failed to delete listener")
+
+	sent := notifier.waitSent(t, 2)
+	first := sent[0]
+	assert.Equal(t, notify.StatusError, first.status)
+	assert.Equal(t, "failed to delete listener", first.content)
+	assert.Equal(t, "1234", first.fields["id"])
+	assert.Equal(t, "loadbalancer", first.fields["name"])
+	assert.Equal(t, "error", first.fields["level"])
+	assert.Regexp(t, `^notify_hook_test\.go:\d+$`, first.fields["caller"])
+	assert.Equal(t, "pool", sent[1].fields["name"])
+
+	fakeClock.SetTime(fakeClock.Now().Add(time.Minute))
+	log.Error("failed to delete listener")
+	sent = notifier.waitSent(t, 3)
+	assert.Equal(t, "4", sent[2].fields[SuppressedField])
+}
+
+func TestNotifyHookRedacted(t *testing.T) {
+	notifier := &fakeNotifier{}
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	hook := NewNotifyHook(notifier, NotifyHookConfig{})
+	defer hook.Close()
+	logger.AddHook(hook)
+	redactor := NewRedactor()
+	redactor.AddSecrets("s3cr3t")
+	InstallRedaction(logger, redactor)
+
+	logger.WithField("url", "https://host/s3cr3t").Error("token s3cr3t rejected")
+
+	sent := notifier.waitSent(t, 1)
+	assert.Equal(t, "token REDACTED rejected", sent[0].content)
+	assert.Equal(t, "https://host/REDACTED", sent[0].fields["url"])
+}
+
+func TestNotifyHookDropsWhenFull(t *testing.T) {
+	notifier := &blockingNotifier{started: make(chan struct{}, 10), release: make(chan struct{})}
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	hook := NewNotifyHook(notifier, NotifyHookConfig{QueueSize: 1, FingerprintFields: []string{"name"}})
+	logger.AddHook(hook)
+
+	logger.WithField("name", 0).Error("failed")
+	<-notifier.started
+	done := make(chan struct{})
+	go func() {
+		// the hook goroutine is blocked on the first one, the second one is queued, the others are dropped
+		for i := 1; i < 5; i++ {
+			logger.WithField("name", i).Error("failed")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a blocked notifier must not block the logger")
+	}
+
+	close(notifier.release)
+	notifier.waitSent(t, 2)
+	logger.WithField("name", "last").Error("failed")
+	hook.Close()
+
+	sent := notifier.waitSent(t, 3)
+	assert.Equal(t, "last", sent[2].fields["name"])
+	assert.Equal(t, "3", sent[2].fields[DroppedField])
+}
+
+func TestNotifyHookSkipsNotifierErrors(t *testing.T) {
+	notifier := &fakeNotifier{}
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	hook := NewNotifyHook(notifier, NotifyHookConfig{})
+	logger.AddHook(hook)
+
+	NewLogr(logger).Error(errors.New("timeout"), notify.SendFailedMessage)
+	hook.Close()
+	assert.Empty(t, notifier.sent)
+}
+
+func TestNotifyHookSendsFatalSynchronously(t *testing.T) {
+	notifier := &syncNotifier{}
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	var exited bool
+	logger.ExitFunc = func(int) {
+		notifier.mutex.Lock()
+		defer notifier.mutex.Unlock()
+		exited = len(notifier.sentSync) == 1
+	}
+	hook := NewNotifyHook(notifier, NotifyHookConfig{})
+	defer hook.Close()
+	logger.AddHook(hook)
+
+	logger.Fatal("cannot start manager")
+	assert.True(t, exited, "the notification must be sent before the process exits")
+
+	logger.Error("cannot reconcile")
+	notifier.waitSent(t, 1)
+}
+
+func TestNotifyHookQueuesFatalWithoutSyncNotifier(t *testing.T) {
+	notifier := &fakeNotifier{}
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	logger.ExitFunc = func(int) {}
+	hook := NewNotifyHook(notifier, NotifyHookConfig{})
+	defer hook.Close()
+	logger.AddHook(hook)
+
+	logger.Fatal("cannot start manager")
+	sent := notifier.waitSent(t, 1)
+	assert.Equal(t, "cannot start manager", sent[0].content)
+}
@@ -0,0 +1,233 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogIDField is the field holding the log ID added by contexts.IContext.Log().
+const LogIDField = "id"
+
+// RecentHandlerPath is the conventional path to mount RecentLogs.Handler on.
+const RecentHandlerPath = "/debug/logs"
+
+// RecentEntry is a copy of a log entry kept by RecentLogs.
+type RecentEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"msg"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// String formats the entry as a single text line.
+func (e RecentEntry) String() string {
+	var builder strings.Builder
+	builder.WriteString(e.Time.Format(time.RFC3339Nano))
+	builder.WriteString(" ")
+	builder.WriteString(e.Level)
+	builder.WriteString(" ")
+	builder.WriteString(e.Message)
+
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		builder.WriteString(" ")
+		builder.WriteString(key)
+		builder.WriteString("=")
+		builder.WriteString(e.Fields[key])
+	}
+	return builder.String()
+}
+
+// recentRecord is an entry kept by RecentLogs. Its data is a snapshot taken by Fire: the scalar
+// values are kept and only formatted when it's read, the others are formatted right away as the
+// caller may change them after logging them.
+type recentRecord struct {
+	time    time.Time
+	level   logrus.Level
+	message string
+	data    logrus.Fields
+}
+
+func newRecentRecord(entry *logrus.Entry) recentRecord {
+	data := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		data[key] = snapshotValue(value)
+	}
+	return recentRecord{
+		time:    entry.Time,
+		level:   entry.Level,
+		message: entry.Message,
+		data:    data,
+	}
+}
+
+func snapshotValue(value interface{}) interface{} {
+	switch value.(type) {
+	case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
+		float32, float64, time.Duration, time.Time:
+		return value
+	}
+	return fmt.Sprint(value)
+}
+
+func (r recentRecord) logID() string {
+	id, _ := r.data[LogIDField].(string)
+	return id
+}
+
+func (r recentRecord) entry() RecentEntry {
+	var fields map[string]string
+	if len(r.data) > 0 {
+		fields = make(map[string]string, len(r.data))
+		for key, value := range r.data {
+			fields[key] = fmt.Sprint(value)
+		}
+	}
+	return RecentEntry{
+		Time:    r.time,
+		Level:   r.level.String(),
+		Message: r.message,
+		Fields:  fields,
+	}
+}
+
+var _ logrus.Hook = &RecentLogs{}
+
+// RecentLogs is a logrus hook keeping the last entries in a bounded ring buffer,
+// they can be queried by log ID or served over HTTP by Handler.
+type RecentLogs struct {
+	mutex   sync.RWMutex
+	entries []recentRecord
+	// next is the index of the next write, the buffer is full once it wrapped
+	next int
+	full bool
+}
+
+// NewRecentLogs creates a RecentLogs keeping the last size entries, install it with logger.AddHook.
+func NewRecentLogs(size int) *RecentLogs {
+	if size <= 0 {
+		size = 1
+	}
+	return &RecentLogs{
+		entries: make([]recentRecord, size),
+	}
+}
+
+func (r *RecentLogs) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (r *RecentLogs) Fire(entry *logrus.Entry) error {
+	record := newRecentRecord(entry)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries[r.next] = record
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+	return nil
+}
+
+// Recent returns up to the last limit entries, oldest first. A limit <= 0 returns all of them.
+func (r *RecentLogs) Recent(limit int) []RecentEntry {
+	return r.filter("", limit)
+}
+
+// RecentByID returns the entries with the log ID id, oldest first.
+func (r *RecentLogs) RecentByID(id string) []RecentEntry {
+	return r.filter(id, 0)
+}
+
+func (r *RecentLogs) filter(id string, limit int) []RecentEntry {
+	records := r.records(id, limit)
+	if records == nil {
+		return nil
+	}
+	result := make([]RecentEntry, len(records))
+	for i, record := range records {
+		result[i] = record.entry()
+	}
+	return result
+}
+
+// records returns up to the last limit records with the log ID id, oldest first.
+func (r *RecentLogs) records(id string, limit int) []recentRecord {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	size := r.next
+	if r.full {
+		size = len(r.entries)
+	}
+	var result []recentRecord
+	// walk from the newest entry back so the limit keeps the most recent ones
+	for i := 0; i < size; i++ {
+		if limit > 0 && len(result) == limit {
+			break
+		}
+		record := r.entries[(r.next-1-i+len(r.entries))%len(r.entries)]
+		if id != "" && record.logID() != id {
+			continue
+		}
+		result = append(result, record)
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// Handler returns a http.Handler serving the recent entries. It accepts the query parameters
+// "id" to filter by log ID, "limit" to return only the last entries, and "format" which is
+// "json" (default) or "text".
+func (r *RecentLogs) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := req.URL.Query()
+		limit := 0
+		if limitStr := query.Get("limit"); limitStr != "" {
+			var err error
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 0 {
+				http.Error(w, fmt.Sprintf("invalid limit %q", limitStr), http.StatusBadRequest)
+				return
+			}
+		}
+		entries := r.filter(query.Get("id"), limit)
+
+		switch query.Get("format") {
+		case "", FormatJSON:
+			w.Header().Set("Content-Type", "application/json")
+			if entries == nil {
+				entries = []RecentEntry{}
+			}
+			_ = json.NewEncoder(w).Encode(entries)
+		case FormatText:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			for _, entry := range entries {
+				_, _ = fmt.Fprintln(w, entry.String())
+			}
+		default:
+			http.Error(w, fmt.Sprintf("invalid format %q", query.Get("format")), http.StatusBadRequest)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecentLogger(size int) (*logrus.Logger, *RecentLogs) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	recent := NewRecentLogs(size)
+	logger.AddHook(recent)
+	return logger, recent
+}
+
+func messages(entries []RecentEntry) []string {
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry.Message)
+	}
+	return result
+}
+
+func TestRecentLogs(t *testing.T) {
+	logger, recent := newRecentLogger(4)
+
+	assert.Empty(t, recent.Recent(0))
+
+	logger.WithField(LogIDField, "1111").Info("a1")
+	logger.WithField(LogIDField, "2222").Info("b1")
+	logger.WithField(LogIDField, "1111").Warn("a2")
+	assert.Equal(t, []string{"a1", "b1", "a2"}, messages(recent.Recent(0)))
+
+	logger.WithField(LogIDField, "2222").Info("b2")
+	logger.WithField(LogIDField, "1111").Error("a3")
+	logger.Info("no id")
+
+	assert.Equal(t, []string{"a2", "b2", "a3", "no id"}, messages(recent.Recent(0)))
+	assert.Equal(t, []string{"a3", "no id"}, messages(recent.Recent(2)))
+	assert.Equal(t, []string{"a2", "a3"}, messages(recent.RecentByID("1111")))
+	assert.Empty(t, recent.RecentByID("3333"))
+
+	entry := recent.RecentByID("1111")[1]
+	assert.Equal(t, "error", entry.Level)
+	assert.Equal(t, map[string]string{LogIDField: "1111"}, entry.Fields)
+}
+
+func TestRecentLogsSnapshotsFields(t *testing.T) {
+	logger, recent := newRecentLogger(10)
+	type loadBalancer struct {
+		Status string
+	}
+	lb := &loadBalancer{Status: "creating"}
+	logger.WithFields(logrus.Fields{LogIDField: "1234", "lb": lb, "attempt": 1}).Info("waiting")
+	lb.Status = "active"
+
+	entries := recent.RecentByID("1234")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "&{creating}", entries[0].Fields["lb"])
+	assert.Equal(t, "1", entries[0].Fields["attempt"])
+}
+
+func TestRecentLogsHandler(t *testing.T) {
+	logger, recent := newRecentLogger(10)
+	logger.WithFields(logrus.Fields{LogIDField: "1111", "name": "lb"}).Info("first")
+	logger.WithField(LogIDField, "2222").Info("second")
+	logger.WithField(LogIDField, "1111").Info("third")
+	handler := recent.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RecentHandlerPath+"?id=1111", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var entries []RecentEntry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+	assert.Equal(t, []string{"first", "third"}, messages(entries))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RecentHandlerPath+"?format=text&limit=2", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], " info second id=2222")
+	assert.Contains(t, lines[1], " info third id=1111")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RecentHandlerPath+"?id=none", nil))
+	assert.JSONEq(t, `[]`, rec.Body.String())
+
+	for _, target := range []string{"?limit=-1", "?limit=x", "?format=xml"} {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, RecentHandlerPath+target, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+	}
+}
+
+func TestNotifyHookAttachesRecentLogs(t *testing.T) {
+	notifier := &fakeNotifier{}
+	logger, recent := newRecentLogger(100)
+	hook := NewNotifyHook(notifier, NotifyHookConfig{Recent: recent, RecentLines: 2})
+	defer hook.Close()
+	logger.AddHook(hook)
+
+	log := logger.WithField(LogIDField, "1111")
+	log.Info("fetching vpc")
+	logger.WithField(LogIDField, "2222").Info("other reconcile")
+	log.Info("creating listener")
+	log.Error("failed to create listener")
+
+	content := notifier.waitSent(t, 1)[0].content
+	assert.True(t, strings.HasPrefix(content, "failed to create listener\n\nRecent logs of 1111:\n"), content)
+	assert.Contains(t, content, "creating listener")
+	assert.Contains(t, content, "error failed to create listener")
+	assert.NotContains(t, content, "fetching vpc")
+	assert.NotContains(t, content, "other reconcile")
+}
+
+func TestNotifyHookAttachesRecentLogsInAnyOrder(t *testing.T) {
+	notifier := &fakeNotifier{}
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	hook := NewNotifyHook(notifier, NotifyHookConfig{Recent: NewRecentLogs(100), RecentLines: 2})
+	defer hook.Close()
+	// the NotifyHook is fired before the RecentLogs hook
+	logger.AddHook(hook)
+	logger.AddHook(hook.config.Recent)
+
+	log := logger.WithField(LogIDField, "1111")
+	log.Info("fetching vpc")
+	log.Info("creating listener")
+	log.Error("failed to create listener")
+
+	content := notifier.waitSent(t, 1)[0].content
+	assert.Contains(t, content, "creating listener")
+	assert.Contains(t, content, "error failed to create listener")
+	assert.NotContains(t, content, "fetching vpc")
+}
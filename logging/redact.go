@@ -0,0 +1,315 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RedactedValue replaces the secrets in the log output.
+const RedactedValue = "REDACTED"
+
+// Default redaction rules of NewDefaultRedactor.
+var (
+	// DefaultSecretPatterns match the Telegram bot tokens, also when they are part of a bot API URL.
+	DefaultSecretPatterns = []string{`bot[0-9]+:[A-Za-z0-9_-]+`}
+	// DefaultSecretFields are matched against the field names, and against the header and query
+	// parameter names by the contexts.Transport, see IsSecretName.
+	DefaultSecretFields = []string{
+		"password", "passwd", "token", "secret", "signature", "authorization",
+		"apikey", "api_key", "api-key", "cookie", "credential",
+	}
+)
+
+// defaultSecretNames is DefaultSecretFields normalized by normalizeSecretName.
+var defaultSecretNames = normalizeSecretNames(DefaultSecretFields)
+
+// IsSecretName reports whether a field, header or query parameter name matches DefaultSecretFields.
+// The name is split in words, on any non alphanumeric character and on the case changes, and matches
+// when one or several consecutive words, optionally followed by "s", spell a secret name regardless
+// of the case and the separators: "X-Api-Key", "accessToken" and "bot_tokens" match but "tokenizer"
+// does not.
+func IsSecretName(name string) bool {
+	return matchSecretName(name, defaultSecretNames)
+}
+
+func matchSecretName(name string, secretNames []string) bool {
+	words := splitWords(name)
+	for i := range words {
+		joined := ""
+		for _, word := range words[i:] {
+			joined += word
+			for _, secretName := range secretNames {
+				if joined == secretName || joined == secretName+"s" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// splitWords splits name in lower case words, "X-APIKey" gives "x", "api" and "key".
+func splitWords(name string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(prev) || nextIsLower {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// normalizeSecretName removes the separators of name and lowers it, so "API-Key" becomes "apikey".
+func normalizeSecretName(name string) string {
+	return strings.Join(splitWords(name), "")
+}
+
+func normalizeSecretNames(names []string) []string {
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = normalizeSecretName(name); name != "" {
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized
+}
+
+var _ logrus.Hook = &Redactor{}
+
+// Redactor is a logrus hook replacing the secrets in the message and the fields of every entry,
+// before the other hooks and the formatter see it. It supports three kinds of rules:
+// known secret values, regular expressions, and field names whose value is always redacted.
+type Redactor struct {
+	mutex    sync.RWMutex
+	secrets  []string
+	patterns []*regexp.Regexp
+	fields   []string
+}
+
+// NewRedactor creates a Redactor without any rule.
+func NewRedactor() *Redactor {
+	return &Redactor{}
+}
+
+// NewDefaultRedactor creates a Redactor with DefaultSecretPatterns and DefaultSecretFields.
+func NewDefaultRedactor() *Redactor {
+	r := NewRedactor()
+	for _, pattern := range DefaultSecretPatterns {
+		r.patterns = append(r.patterns, regexp.MustCompile(pattern))
+	}
+	r.AddFields(DefaultSecretFields...)
+	return r
+}
+
+// InstallRedaction adds r to the hooks of logger, in front of the hooks already installed.
+func InstallRedaction(logger *logrus.Logger, r *Redactor) {
+	hooks := make(logrus.LevelHooks)
+	for _, level := range r.Levels() {
+		hooks[level] = []logrus.Hook{r}
+	}
+	for level, existing := range logger.Hooks {
+		hooks[level] = append(hooks[level], existing...)
+	}
+	logger.ReplaceHooks(hooks)
+}
+
+// AddSecrets registers known secret values such as a bot token, empty values are ignored.
+func (r *Redactor) AddSecrets(values ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, value := range values {
+		if value != "" {
+			r.secrets = append(r.secrets, value)
+		}
+	}
+}
+
+// AddPattern registers a regular expression, every match is redacted.
+func (r *Redactor) AddPattern(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.patterns = append(r.patterns, re)
+	return nil
+}
+
+// AddFields registers field names, a field whose name matches one of them as described by IsSecretName
+// is always redacted, also when it's a key of a map or a field of a struct logged as a field value.
+func (r *Redactor) AddFields(names ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.fields = append(r.fields, normalizeSecretNames(names)...)
+}
+
+// Redact returns s with every known secret and pattern match replaced by RedactedValue.
+func (r *Redactor) Redact(s string) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.redact(s)
+}
+
+func (r *Redactor) redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, RedactedValue)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllLiteralString(s, RedactedValue)
+	}
+	return s
+}
+
+func (r *Redactor) isSecretField(name string) bool {
+	return matchSecretName(name, r.fields)
+}
+
+func (r *Redactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (r *Redactor) Fire(entry *logrus.Entry) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	entry.Message = r.redact(entry.Message)
+	for key, value := range entry.Data {
+		if r.isSecretField(key) {
+			entry.Data[key] = RedactedValue
+			continue
+		}
+		if redacted, changed := r.redactValue(reflect.ValueOf(value), maxRedactionDepth); changed {
+			entry.Data[key] = redacted
+		}
+	}
+	return nil
+}
+
+// maxRedactionDepth bounds the nesting of the values walked by redactValue, which also protects
+// it against cyclic values.
+const maxRedactionDepth = 5
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// redactValue returns a redacted copy of value and true when it holds a secret. Strings, errors
+// and Stringers are redacted as text. Maps, structs and slices are walked, the map keys and struct
+// fields matching a secret field are replaced, and the copy is a map[string]interface{} or a
+// []interface{}. Any other value is left alone.
+func (r *Redactor) redactValue(value reflect.Value, depth int) (interface{}, bool) {
+	if !value.IsValid() || depth == 0 {
+		return nil, false
+	}
+	switch {
+	case value.Kind() == reflect.String:
+		s := value.String()
+		redacted := r.redact(s)
+		return redacted, redacted != s
+	case value.Type().Implements(errorType):
+		if value.Kind() == reflect.Pointer && value.IsNil() {
+			return nil, false
+		}
+		s := value.Interface().(error).Error()
+		redacted := r.redact(s)
+		return errors.New(redacted), redacted != s
+	case value.Type().Implements(stringerType):
+		if value.Kind() == reflect.Pointer && value.IsNil() {
+			return nil, false
+		}
+		s := value.Interface().(fmt.Stringer).String()
+		redacted := r.redact(s)
+		return redacted, redacted != s
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil, false
+		}
+		return r.redactValue(value.Elem(), depth-1)
+	case reflect.Map:
+		result := make(map[string]interface{}, value.Len())
+		changed := false
+		iter := value.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			result[key], changed = r.redactMember(key, iter.Value(), depth, changed)
+		}
+		return result, changed
+	case reflect.Struct:
+		result := make(map[string]interface{}, value.NumField())
+		changed := false
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Name
+			if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			result[name], changed = r.redactMember(name, value.Field(i), depth, changed)
+		}
+		return result, changed
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			// []byte is logged as is
+			return nil, false
+		}
+		result := make([]interface{}, value.Len())
+		changed := false
+		for i := range result {
+			redacted, ok := r.redactValue(value.Index(i), depth-1)
+			if ok {
+				result[i], changed = redacted, true
+			} else {
+				result[i] = value.Index(i).Interface()
+			}
+		}
+		return result, changed
+	default:
+		return nil, false
+	}
+}
+
+// redactMember returns the redacted value of the map key or struct field name, and whether the
+// copy holding it changed so far.
+func (r *Redactor) redactMember(name string, value reflect.Value, depth int, changed bool) (interface{}, bool) {
+	if r.isSecretField(name) {
+		return RedactedValue, true
+	}
+	if redacted, ok := r.redactValue(value, depth-1); ok {
+		return redacted, true
+	}
+	return value.Interface(), changed
+}
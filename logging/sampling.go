@@ -0,0 +1,299 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/utils/clock"
+)
+
+// SuppressedField holds the number of entries dropped by the sampler in a summary entry.
+const SuppressedField = "suppressed"
+
+// SamplingPolicy describes how the entries of a level sharing the same key are sampled
+// within an interval: the first First go through, then one in every Thereafter.
+type SamplingPolicy struct {
+	First int
+	// Thereafter of 0 drops every entry after the first ones.
+	Thereafter int
+}
+
+// defaultSamplingInterval is used when SamplingConfig.Interval is not positive.
+const defaultSamplingInterval = time.Second
+
+// SamplingConfig configures a SamplingFormatter.
+type SamplingConfig struct {
+	// Interval is the window after which the counters of a key are reset and a summary of the
+	// suppressed entries is written, one second when not positive.
+	Interval time.Duration
+	// KeyFields are the fields identifying similar entries together with the level and message,
+	// e.g. "name" to sample each reconciled object separately.
+	KeyFields []string
+	// Levels holds the policy of each sampled level, entries of other levels are never sampled.
+	Levels map[logrus.Level]SamplingPolicy
+	// Clock is the real clock when nil.
+	Clock clock.PassiveClock
+}
+
+type samplingCounter struct {
+	start      time.Time
+	count      int
+	suppressed int
+	// entry is the last entry of the key, used to build the summary
+	entry *logrus.Entry
+}
+
+var _ logrus.Formatter = &SamplingFormatter{}
+var _ logrus.Hook = &samplingHook{}
+
+// SamplingFormatter wraps a formatter and drops the entries exceeding the sampling policy of their level,
+// logrus writes nothing when a formatter returns no bytes. When the next window of a key starts,
+// a "suppressed K similar messages" summary is written before the entry; Flush writes the summaries
+// of the keys which got no new entry. The keys whose window is over are forgotten once per interval.
+type SamplingFormatter struct {
+	logrus.Formatter
+	config SamplingConfig
+
+	mutex     sync.Mutex
+	counters  map[string]*samplingCounter
+	lastSweep time.Time
+	// decisions holds whether the entries sampled by the hook of InstallSampling are kept,
+	// until they reach Format
+	decisions map[*logrus.Entry]bool
+}
+
+// NewSamplingFormatter wraps formatter with the sampling described by config.
+// Use InstallSampling instead so the hooks of the logger are sampled too.
+func NewSamplingFormatter(formatter logrus.Formatter, config SamplingConfig) *SamplingFormatter {
+	if config.Clock == nil {
+		config.Clock = clock.RealClock{}
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultSamplingInterval
+	}
+	return &SamplingFormatter{
+		Formatter: formatter,
+		config:    config,
+		counters:  map[string]*samplingCounter{},
+		lastSweep: config.Clock.Now(),
+		decisions: map[*logrus.Entry]bool{},
+	}
+}
+
+// InstallSampling wraps the formatter of logger with sampling, it must be called after Configure.
+// It also applies to the loggers returned by ComponentLogger for logger.
+// The sampling is decided by a hook fired before the hooks of logger, which skip the dropped entries,
+// so it must be called after adding them: a hook added later sees every entry.
+func InstallSampling(logger *logrus.Logger, config SamplingConfig) *SamplingFormatter {
+	sampler := NewSamplingFormatter(logger.Formatter, config)
+
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(&samplingHook{sampler: sampler})
+	for level, levelHooks := range logger.Hooks {
+		for _, hook := range levelHooks {
+			hooks[level] = append(hooks[level], &sampledHook{Hook: hook, sampler: sampler})
+		}
+	}
+	logger.ReplaceHooks(hooks)
+	logger.SetFormatter(sampler)
+	return sampler
+}
+
+func (f *SamplingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !f.sampled(entry) {
+		return f.Formatter.Format(entry)
+	}
+
+	f.mutex.Lock()
+	keep, decided := f.decisions[entry]
+	delete(f.decisions, entry)
+	f.mutex.Unlock()
+
+	var summaries []*logrus.Entry
+	if !decided {
+		keep, summaries = f.decide(entry)
+	}
+
+	var result []byte
+	for _, summary := range summaries {
+		serialized, err := f.Formatter.Format(summary)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, serialized...)
+	}
+	if keep {
+		serialized, err := f.Formatter.Format(entry)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, serialized...)
+	}
+	return result, nil
+}
+
+// sampled reports whether entry is subject to sampling, summaries never are.
+func (f *SamplingFormatter) sampled(entry *logrus.Entry) bool {
+	if _, ok := f.config.Levels[entry.Level]; !ok {
+		return false
+	}
+	_, summary := entry.Data[SuppressedField]
+	return !summary
+}
+
+// decide counts entry and reports whether it's kept, with the summaries to write before it:
+// the one of its key when a new window starts, and those of the keys forgotten by the sweep.
+func (f *SamplingFormatter) decide(entry *logrus.Entry) (bool, []*logrus.Entry) {
+	policy := f.config.Levels[entry.Level]
+	key := f.key(entry)
+	now := f.config.Clock.Now()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	counter, ok := f.counters[key]
+	if !ok {
+		counter = &samplingCounter{start: now}
+		f.counters[key] = counter
+	}
+	var summaries []*logrus.Entry
+	if now.Sub(counter.start) >= f.config.Interval {
+		if counter.suppressed > 0 {
+			summaries = append(summaries, summaryEntry(counter.entry, counter.suppressed))
+		}
+		counter.start, counter.count, counter.suppressed = now, 0, 0
+	}
+	counter.count++
+	keep := counter.count <= policy.First ||
+		(policy.Thereafter > 0 && (counter.count-policy.First)%policy.Thereafter == 0)
+	if !keep {
+		counter.suppressed++
+		counter.entry = entry.Dup()
+		counter.entry.Level, counter.entry.Message = entry.Level, entry.Message
+	}
+
+	if now.Sub(f.lastSweep) >= f.config.Interval {
+		f.lastSweep = now
+		summaries = append(summaries, f.sweep(now)...)
+	}
+	return keep, summaries
+}
+
+// sweep forgets the keys whose window is over and returns their summaries, f.mutex must be held.
+func (f *SamplingFormatter) sweep(now time.Time) []*logrus.Entry {
+	var summaries []*logrus.Entry
+	for key, counter := range f.counters {
+		if now.Sub(counter.start) < f.config.Interval {
+			continue
+		}
+		if counter.suppressed > 0 {
+			summaries = append(summaries, summaryEntry(counter.entry, counter.suppressed))
+		}
+		delete(f.counters, key)
+	}
+	return summaries
+}
+
+// Flush writes through logger a summary for every key whose window is over and which suppressed entries,
+// and forgets the keys whose window is over.
+func (f *SamplingFormatter) Flush(logger *logrus.Logger) {
+	now := f.config.Clock.Now()
+
+	f.mutex.Lock()
+	f.lastSweep = now
+	summaries := f.sweep(now)
+	f.mutex.Unlock()
+
+	for _, summary := range summaries {
+		logger.WithFields(summary.Data).Log(summary.Level, summary.Message)
+	}
+}
+
+// Run calls Flush every interval until ctx is done.
+func (f *SamplingFormatter) Run(ctx context.Context, logger *logrus.Logger) {
+	ticker := time.NewTicker(f.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.Flush(logger)
+		}
+	}
+}
+
+// kept reports whether entry was not dropped by the sampling hook.
+func (f *SamplingFormatter) kept(entry *logrus.Entry) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	keep, decided := f.decisions[entry]
+	return !decided || keep
+}
+
+// samplingHook decides the sampling of the entries before the other hooks see them. The summaries are
+// logged through the logger of the entry, hooks are fired outside of the logger lock.
+type samplingHook struct {
+	sampler *SamplingFormatter
+}
+
+func (h *samplingHook) Levels() []logrus.Level {
+	levels := make([]logrus.Level, 0, len(h.sampler.config.Levels))
+	for level := range h.sampler.config.Levels {
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+func (h *samplingHook) Fire(entry *logrus.Entry) error {
+	if !h.sampler.sampled(entry) {
+		return nil
+	}
+	keep, summaries := h.sampler.decide(entry)
+	h.sampler.mutex.Lock()
+	h.sampler.decisions[entry] = keep
+	h.sampler.mutex.Unlock()
+
+	for _, summary := range summaries {
+		entry.Logger.WithFields(summary.Data).Log(summary.Level, summary.Message)
+	}
+	return nil
+}
+
+// sampledHook fires Hook only for the entries kept by the sampling.
+type sampledHook struct {
+	logrus.Hook
+	sampler *SamplingFormatter
+}
+
+func (h *sampledHook) Fire(entry *logrus.Entry) error {
+	if !h.sampler.kept(entry) {
+		return nil
+	}
+	return h.Hook.Fire(entry)
+}
+
+func (f *SamplingFormatter) key(entry *logrus.Entry) string {
+	var builder strings.Builder
+	builder.WriteString(entry.Level.String())
+	builder.WriteByte(0)
+	builder.WriteString(entry.Message)
+	for _, field := range f.config.KeyFields {
+		builder.WriteByte(0)
+		if value, ok := entry.Data[field]; ok {
+			builder.WriteString(fmt.Sprint(value))
+		}
+	}
+	return builder.String()
+}
+
+func summaryEntry(last *logrus.Entry, suppressed int) *logrus.Entry {
+	summary := last.Dup()
+	summary.Level = last.Level
+	summary.Message = fmt.Sprintf("suppressed %d similar messages: %s", suppressed, last.Message)
+	summary.Data[SuppressedField] = suppressed
+	return summary
+}
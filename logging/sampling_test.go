@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func newSampledLogger(t *testing.T, level string) (*logrus.Logger, *bytes.Buffer, *SamplingFormatter, *clocktesting.FakePassiveClock) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	require.NoError(t, Configure(logger, Config{Level: level, DisableCaller: true, Format: FormatJSON}))
+
+	fakeClock := clocktesting.NewFakePassiveClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	sampler := InstallSampling(logger, SamplingConfig{
+		Interval:  time.Minute,
+		KeyFields: []string{"name"},
+		Levels: map[logrus.Level]SamplingPolicy{
+			logrus.InfoLevel: {First: 2, Thereafter: 3},
+		},
+		Clock: fakeClock,
+	})
+	return logger, &buf, sampler, fakeClock
+}
+
+func countLines(buf *bytes.Buffer, substring string) int {
+	count := 0
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, substring) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestSamplingFormatter(t *testing.T) {
+	logger, buf, _, fakeClock := newSampledLogger(t, "info")
+
+	for i := 0; i < 10; i++ {
+		logger.WithField("name", "lb-1").Info("requeue after duration")
+		logger.WithField("name", "lb-1").Error("reconcile failed")
+	}
+	logger.WithField("name", "lb-2").Info("requeue after duration")
+
+	// first 2, then the 5th and 8th
+	assert.Equal(t, 4, countLines(buf, `"msg":"requeue after duration","name":"lb-1"`))
+	assert.Equal(t, 10, countLines(buf, "reconcile failed"), "error level must not be sampled")
+	assert.Equal(t, 1, countLines(buf, `"name":"lb-2"`))
+
+	buf.Reset()
+	fakeClock.SetTime(fakeClock.Now().Add(time.Minute))
+	logger.WithField("name", "lb-1").Info("requeue after duration")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"msg":"suppressed 6 similar messages: requeue after duration"`)
+	assert.Contains(t, lines[0], `"suppressed":6`)
+	assert.Contains(t, lines[1], `"msg":"requeue after duration"`)
+}
+
+func TestSamplingFormatterFlush(t *testing.T) {
+	logger, buf, sampler, fakeClock := newSampledLogger(t, "info")
+
+	for i := 0; i < 4; i++ {
+		logger.WithField("name", "lb-1").Info("requeue after duration")
+	}
+	sampler.Flush(logger)
+	assert.Equal(t, 0, countLines(buf, "suppressed"), "window is not over yet")
+
+	fakeClock.SetTime(fakeClock.Now().Add(2 * time.Minute))
+	sampler.Flush(logger)
+	assert.Equal(t, 1, countLines(buf, "suppressed 2 similar messages"))
+
+	buf.Reset()
+	sampler.Flush(logger)
+	assert.Empty(t, buf.String(), "summary must be written once")
+}
+
+func TestSamplingComponentLogger(t *testing.T) {
+	logger, buf, _, _ := newSampledLogger(t, "notify=warn,loadbalancer=debug,default=info")
+
+	for i := 0; i < 5; i++ {
+		ComponentLogger(logger, "notify").Info("filtered")
+		ComponentLogger(logger, "loadbalancer").Info("sampled")
+	}
+	assert.Equal(t, 0, countLines(buf, "filtered"))
+	assert.Equal(t, 3, countLines(buf, "sampled"))
+}
+
+func TestSamplingSkipsHooks(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	require.NoError(t, Configure(logger, Config{DisableCaller: true, Format: FormatJSON}))
+	hook := test.NewLocal(logger)
+	fakeClock := clocktesting.NewFakePassiveClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	InstallSampling(logger, SamplingConfig{
+		Interval: time.Minute,
+		Levels:   map[logrus.Level]SamplingPolicy{logrus.InfoLevel: {First: 1}},
+		Clock:    fakeClock,
+	})
+
+	for i := 0; i < 3; i++ {
+		logger.Info("requeue after duration")
+	}
+	assert.Len(t, hook.AllEntries(), 1, "hooks must not see the dropped entries")
+
+	fakeClock.SetTime(fakeClock.Now().Add(time.Minute))
+	logger.Info("requeue after duration")
+	entries := hook.AllEntries()
+	require.Len(t, entries, 3)
+	assert.Equal(t, "suppressed 2 similar messages: requeue after duration", entries[1].Message)
+	assert.Equal(t, 1, countLines(&buf, "suppressed 2 similar messages"))
+}
+
+func TestSamplingForgetsExpiredKeys(t *testing.T) {
+	logger, buf, sampler, fakeClock := newSampledLogger(t, "info")
+
+	for i := 0; i < 100; i++ {
+		logger.WithField("name", fmt.Sprintf("lb-%d", i)).Info("requeue after duration")
+	}
+	for i := 0; i < 3; i++ {
+		logger.WithField("name", "lb-0").Info("requeue after duration")
+	}
+	assert.Len(t, sampler.counters, 100)
+
+	buf.Reset()
+	fakeClock.SetTime(fakeClock.Now().Add(time.Minute))
+	logger.WithField("name", "lb-new").Info("requeue after duration")
+	assert.Len(t, sampler.counters, 1)
+	assert.Equal(t, 1, countLines(buf, "suppressed 2 similar messages"), "the summary of a forgotten key is written")
+}
+
+func TestSamplingDefaultInterval(t *testing.T) {
+	sampler := NewSamplingFormatter(&logrus.TextFormatter{}, SamplingConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotPanics(t, func() { sampler.Run(ctx, logrus.New()) })
+}
@@ -0,0 +1,37 @@
+package multilock
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anngdinh/operator-helper/errs"
+)
+
+var _ error = &LockError{}
+
+// LockError is returned when the lock of Key could not be acquired before the context is done.
+// It wraps the context error and an errs.NeedRequeue, so errs.HandleReconcileError requeues the item.
+type LockError struct {
+	Key interface{}
+	Err error
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("failed to acquire lock %v: %v", e.Key, e.Err)
+}
+
+func (e *LockError) Unwrap() []error {
+	return []error{e.Err, errs.NewNeedRequeue(e.Error())}
+}
+
+// LockContext is like Lock but gives up when ctx is done before the lock is acquired.
+func (mLock *TypedMultiLock[K]) LockContext(ctx context.Context, key K) error {
+	mLock.checkOrder(ctx, key)
+	return mLock.lock(ctx, key, true, true)
+}
+
+// RLockContext is like RLock but gives up when ctx is done before the lock is acquired.
+func (mLock *TypedMultiLock[K]) RLockContext(ctx context.Context, key K) error {
+	mLock.checkOrder(ctx, key)
+	return mLock.lock(ctx, key, false, true)
+}
@@ -0,0 +1,111 @@
+package multilock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anngdinh/operator-helper/errs"
+)
+
+func TestLockContextTimeout(t *testing.T) {
+	locker := NewMultipleLock()
+	locker.Lock("key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := locker.LockContext(ctx, "key")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var lockErr *LockError
+	require.ErrorAs(t, err, &lockErr)
+	assert.Equal(t, "key", lockErr.Key)
+
+	result, err := errs.HandleReconcileError(err, logrus.NewEntry(logrus.New()))
+	assert.NoError(t, err)
+	assert.True(t, result.Requeue)
+
+	// the waiter which gave up no longer references the lock
+	assert.Equal(t, 1, counter(locker, "key"))
+	locker.Unlock("key")
+	assert.Equal(t, 0, countKeys(locker.TypedMultiLock))
+
+	require.NoError(t, locker.LockContext(context.Background(), "key"))
+	locker.Unlock("key")
+	assert.Equal(t, 0, countKeys(locker.TypedMultiLock))
+}
+
+func TestLockContextAcquired(t *testing.T) {
+	locker := NewMultipleLock()
+	locker.Lock("key")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		locker.Unlock("key")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, locker.LockContext(ctx, "key"))
+	locker.Unlock("key")
+	assert.Equal(t, 0, countKeys(locker.TypedMultiLock))
+}
+
+func TestRLockContext(t *testing.T) {
+	locker := NewMultipleLock()
+	locker.RLock("key")
+
+	// readers share the lock
+	require.NoError(t, locker.RLockContext(context.Background(), "key"))
+	locker.RUnlock("key")
+
+	locker.RUnlock("key")
+	locker.Lock("key")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := locker.RLockContext(ctx, "key")
+	assert.True(t, errors.Is(err, context.Canceled))
+	locker.Unlock("key")
+	assert.Equal(t, 0, countKeys(locker.TypedMultiLock))
+}
+
+func TestLockContextWriterGivesUp(t *testing.T) {
+	locker := NewMultipleLock()
+	locker.RLock("key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- locker.LockContext(ctx, "key")
+	}()
+	waitFor(t, func() bool { return counter(locker, "key") == 2 })
+	assert.False(t, locker.TryRLock("key"), "a waiting writer keeps new readers out")
+
+	readCh := make(chan error, 1)
+	go func() {
+		readCh <- locker.RLockContext(context.Background(), "key")
+	}()
+	waitFor(t, func() bool { return counter(locker, "key") == 3 })
+	cancel()
+	assert.ErrorIs(t, <-errCh, context.Canceled)
+	require.NoError(t, <-readCh, "the reader gets the lock once the writer gave up")
+
+	locker.RUnlock("key")
+	locker.RUnlock("key")
+	assert.Equal(t, 0, countKeys(locker.TypedMultiLock))
+}
+
+func countKeys[K comparable](locker *TypedMultiLock[K]) int {
+	count := 0
+	for i := range locker.shards {
+		sh := &locker.shards[i]
+		sh.iLock.Lock()
+		count += len(sh.inUse)
+		sh.iLock.Unlock()
+	}
+	return count
+}
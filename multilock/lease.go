@@ -0,0 +1,292 @@
+package multilock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Defaults of LeaseConfig, the same as the leader election of controller-runtime.
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewInterval = 5 * time.Second
+	DefaultRetryInterval = 2 * time.Second
+)
+
+// LeaseConfig configures a LeaseLock.
+type LeaseConfig struct {
+	// Namespace of the Lease objects.
+	Namespace string
+	// Identity of this process written as the holder of the Leases, e.g. the pod name.
+	Identity string
+	// LeaseDuration after which a Lease which is not renewed can be taken over.
+	LeaseDuration time.Duration
+	// RenewInterval between the renewals of a held Lease, it must be lower than LeaseDuration.
+	RenewInterval time.Duration
+	// RetryInterval between the attempts to acquire a Lease held by another process.
+	RetryInterval time.Duration
+	// Clock is the real clock when nil.
+	Clock clock.WithTicker
+	// Log is used to report the renewal failures and the lost Leases, the standard logger when nil.
+	Log *logrus.Entry
+}
+
+// LeaseLock is a Locker storing the lock of every key in a coordination.k8s.io/v1 Lease named
+// after the key, so it's shared by every process using the same namespace. The keys must be
+// valid object names. A held Lease is renewed in the background until Unlock, see Lost to
+// learn when it could not be.
+// Goroutines of the same process are serialized by a TypedMultiLock before taking the Lease.
+type LeaseLock struct {
+	client client.Client
+	config LeaseConfig
+	local  *TypedMultiLock[string]
+
+	mutex sync.Mutex
+	held  map[string]*heldLease
+}
+
+type heldLease struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	// lost is closed once the Lease is no longer held
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+func (h *heldLease) setLost() {
+	h.lostOnce.Do(func() {
+		close(h.lost)
+	})
+}
+
+func NewLeaseLock(c client.Client, config LeaseConfig) (*LeaseLock, error) {
+	if config.Namespace == "" || config.Identity == "" {
+		return nil, fmt.Errorf("lease lock needs a namespace and an identity")
+	}
+	if config.LeaseDuration <= 0 {
+		config.LeaseDuration = DefaultLeaseDuration
+	}
+	if config.RenewInterval <= 0 {
+		config.RenewInterval = DefaultRenewInterval
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+	if config.RenewInterval >= config.LeaseDuration {
+		return nil, fmt.Errorf("renew interval %s must be lower than the lease duration %s", config.RenewInterval, config.LeaseDuration)
+	}
+	if config.Clock == nil {
+		config.Clock = clock.RealClock{}
+	}
+	if config.Log == nil {
+		config.Log = logrus.NewEntry(logrus.StandardLogger())
+	}
+	return &LeaseLock{
+		client: c,
+		config: config,
+		local:  New[string](),
+		held:   map[string]*heldLease{},
+	}, nil
+}
+
+// LockContext blocks until the Lease of key is held by this process. A Lease held by another
+// identity is taken over once it has not been renewed for LeaseDuration. The API errors are
+// retried every RetryInterval, except the ones retrying can't fix, such as missing permissions.
+func (l *LeaseLock) LockContext(ctx context.Context, key string) error {
+	if err := l.local.LockContext(ctx, key); err != nil {
+		return err
+	}
+	for {
+		acquired, err := l.tryAcquire(ctx, key)
+		if err != nil && ctx.Err() == nil {
+			if isTerminal(err) {
+				l.local.Unlock(key)
+				return fmt.Errorf("failed to acquire lease %s/%s: %w", l.config.Namespace, key, err)
+			}
+			l.config.Log.WithField("lease", key).WithError(err).Warn("failed to acquire lease, retrying")
+		}
+		if acquired {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			l.local.Unlock(key)
+			return &LockError{Key: key, Err: ctx.Err()}
+		case <-l.config.Clock.After(l.config.RetryInterval):
+		}
+	}
+
+	renewCtx, cancel := context.WithCancel(context.Background())
+	held := &heldLease{cancel: cancel, done: make(chan struct{}), lost: make(chan struct{})}
+	l.mutex.Lock()
+	l.held[key] = held
+	l.mutex.Unlock()
+	go l.renew(renewCtx, key, held)
+	return nil
+}
+
+// Lost returns a channel closed once the Lease of key is no longer held by this process: it was
+// taken over by another identity, it could not be renewed for LeaseDuration, or it was unlocked.
+// The work protected by the lock should stop then. The channel is closed already when key is not
+// locked.
+func (l *LeaseLock) Lost(key string) <-chan struct{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if held, ok := l.held[key]; ok {
+		return held.lost
+	}
+	lost := make(chan struct{})
+	close(lost)
+	return lost
+}
+
+// Unlock is like TryUnlock but logs the failures.
+func (l *LeaseLock) Unlock(key string) {
+	if err := l.TryUnlock(key); err != nil {
+		l.config.Log.WithField("lease", key).WithError(err).Warn("failed to release lease")
+	}
+}
+
+// TryUnlock stops renewing the Lease of key and releases it, so another process can take it
+// right away.
+func (l *LeaseLock) TryUnlock(key string) error {
+	l.mutex.Lock()
+	held, ok := l.held[key]
+	delete(l.held, key)
+	l.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("Unlock of %v: %w", key, ErrNotLocked)
+	}
+	held.cancel()
+	<-held.done
+	held.setLost()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.config.RenewInterval)
+	defer cancel()
+	err := l.release(ctx, key)
+	if unlockErr := l.local.TryUnlock(key); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+// isTerminal reports whether the API error err can't go away by retrying.
+func isTerminal(err error) bool {
+	return apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) || apierrors.IsInvalid(err) ||
+		apierrors.IsBadRequest(err) || apierrors.IsMethodNotSupported(err) || apierrors.IsNotFound(err)
+}
+
+func (l *LeaseLock) tryAcquire(ctx context.Context, key string) (bool, error) {
+	now := metav1.NewMicroTime(l.config.Clock.Now())
+	lease := &coordinationv1.Lease{}
+	err := l.client.Get(ctx, client.ObjectKey{Namespace: l.config.Namespace, Name: key}, lease)
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: l.config.Namespace, Name: key},
+			Spec:       l.spec(now, 0),
+		}
+		err = l.client.Create(ctx, lease)
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	if l.heldByOther(lease) {
+		return false, nil
+	}
+
+	transitions := ptr.Deref(lease.Spec.LeaseTransitions, 0)
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != l.config.Identity {
+		transitions++
+	}
+	lease.Spec = l.spec(now, transitions)
+	err = l.client.Update(ctx, lease)
+	if apierrors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// heldByOther reports whether lease is held by another identity which renewed it recently.
+func (l *LeaseLock) heldByOther(lease *coordinationv1.Lease) bool {
+	holder := ptr.Deref(lease.Spec.HolderIdentity, "")
+	if holder == "" || holder == l.config.Identity || lease.Spec.RenewTime == nil {
+		return false
+	}
+	duration := time.Duration(ptr.Deref(lease.Spec.LeaseDurationSeconds, 0)) * time.Second
+	return l.config.Clock.Since(lease.Spec.RenewTime.Time) < duration
+}
+
+func (l *LeaseLock) spec(now metav1.MicroTime, transitions int32) coordinationv1.LeaseSpec {
+	return coordinationv1.LeaseSpec{
+		HolderIdentity:       ptr.To(l.config.Identity),
+		LeaseDurationSeconds: ptr.To(int32(l.config.LeaseDuration.Round(time.Second) / time.Second)),
+		AcquireTime:          &now,
+		RenewTime:            &now,
+		LeaseTransitions:     ptr.To(transitions),
+	}
+}
+
+// renew renews the Lease of key until ctx is done, and marks it lost once it was taken over or
+// could not be renewed for LeaseDuration.
+func (l *LeaseLock) renew(ctx context.Context, key string, held *heldLease) {
+	defer close(held.done)
+	log := l.config.Log.WithField("lease", key)
+	renewed := l.config.Clock.Now()
+	ticker := l.config.Clock.NewTicker(l.config.RenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		lease := &coordinationv1.Lease{}
+		err := l.client.Get(ctx, client.ObjectKey{Namespace: l.config.Namespace, Name: key}, lease)
+		if err == nil {
+			if holder := ptr.Deref(lease.Spec.HolderIdentity, ""); holder != l.config.Identity {
+				log.Error("lease was taken over by ", holder)
+				held.setLost()
+				return
+			}
+			now := l.config.Clock.Now()
+			lease.Spec.RenewTime = ptr.To(metav1.NewMicroTime(now))
+			if err = l.client.Update(ctx, lease); err == nil {
+				renewed = now
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			if l.config.Clock.Since(renewed) >= l.config.LeaseDuration {
+				log.WithError(err).Error("lease was lost, it could not be renewed for ", l.config.LeaseDuration)
+				held.setLost()
+				return
+			}
+			log.WithError(err).Warn("failed to renew lease")
+		}
+	}
+}
+
+func (l *LeaseLock) release(ctx context.Context, key string) error {
+	lease := &coordinationv1.Lease{}
+	if err := l.client.Get(ctx, client.ObjectKey{Namespace: l.config.Namespace, Name: key}, lease); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if ptr.Deref(lease.Spec.HolderIdentity, "") != l.config.Identity {
+		return nil
+	}
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.RenewTime = nil
+	return l.client.Update(ctx, lease)
+}
@@ -0,0 +1,319 @@
+package multilock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/anngdinh/operator-helper/errs"
+)
+
+func newTestLeaseLock(t *testing.T, c client.Client, fakeClock *clocktesting.FakeClock, identity string) *LeaseLock {
+	t.Helper()
+	lock, err := NewLeaseLock(c, LeaseConfig{
+		Namespace:     "default",
+		Identity:      identity,
+		LeaseDuration: 15 * time.Second,
+		RenewInterval: 5 * time.Second,
+		RetryInterval: time.Second,
+		Clock:         fakeClock,
+	})
+	require.NoError(t, err)
+	return lock
+}
+
+func getLease(t *testing.T, c client.Client, name string) *coordinationv1.Lease {
+	t.Helper()
+	lease := &coordinationv1.Lease{}
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, lease))
+	return lease
+}
+
+func TestLeaseLockAcquireRelease(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	a := newTestLeaseLock(t, c, fakeClock, "operator-a")
+	b := newTestLeaseLock(t, c, fakeClock, "operator-b")
+
+	require.NoError(t, a.LockContext(context.Background(), "lb-1"))
+	lease := getLease(t, c, "lb-1")
+	assert.Equal(t, "operator-a", ptr.Deref(lease.Spec.HolderIdentity, ""))
+	assert.Equal(t, int32(15), ptr.Deref(lease.Spec.LeaseDurationSeconds, 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := b.LockContext(ctx, "lb-1")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	result, err := errs.HandleReconcileError(err, logrus.NewEntry(logrus.New()))
+	assert.NoError(t, err)
+	assert.True(t, result.Requeue)
+
+	require.NoError(t, a.TryUnlock("lb-1"))
+	assert.Nil(t, getLease(t, c, "lb-1").Spec.HolderIdentity)
+	assert.ErrorIs(t, a.TryUnlock("lb-1"), ErrNotLocked)
+
+	require.NoError(t, b.LockContext(context.Background(), "lb-1"))
+	lease = getLease(t, c, "lb-1")
+	assert.Equal(t, "operator-b", ptr.Deref(lease.Spec.HolderIdentity, ""))
+	assert.Equal(t, int32(1), ptr.Deref(lease.Spec.LeaseTransitions, 0))
+	require.NoError(t, b.TryUnlock("lb-1"))
+}
+
+func TestLeaseLockTakeOverExpired(t *testing.T) {
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	renewTime := metav1.NewMicroTime(fakeClock.Now())
+	c := fake.NewClientBuilder().WithObjects(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "lb-1"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       ptr.To("crashed"),
+			LeaseDurationSeconds: ptr.To(int32(15)),
+			RenewTime:            &renewTime,
+		},
+	}).Build()
+	b := newTestLeaseLock(t, c, fakeClock, "operator-b")
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- b.LockContext(context.Background(), "lb-1")
+	}()
+	assert.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	select {
+	case err := <-acquired:
+		t.Fatalf("lease should not be acquired before it expires, got %v", err)
+	default:
+	}
+
+	fakeClock.Step(16 * time.Second)
+	select {
+	case err := <-acquired:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("expired lease was not taken over")
+	}
+	lease := getLease(t, c, "lb-1")
+	assert.Equal(t, "operator-b", ptr.Deref(lease.Spec.HolderIdentity, ""))
+	assert.Equal(t, int32(1), ptr.Deref(lease.Spec.LeaseTransitions, 0))
+	require.NoError(t, b.TryUnlock("lb-1"))
+}
+
+func TestLeaseLockRenew(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakeClock(start)
+	a := newTestLeaseLock(t, c, fakeClock, "operator-a")
+
+	require.NoError(t, a.LockContext(context.Background(), "lb-1"))
+	assert.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	fakeClock.Step(5 * time.Second)
+	assert.Eventually(t, func() bool {
+		return getLease(t, c, "lb-1").Spec.RenewTime.Time.Equal(start.Add(5 * time.Second))
+	}, time.Second, time.Millisecond)
+	assert.True(t, getLease(t, c, "lb-1").Spec.AcquireTime.Time.Equal(start))
+	require.NoError(t, a.TryUnlock("lb-1"))
+}
+
+func TestLeaseLockSameProcess(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	a := newTestLeaseLock(t, c, clocktesting.NewFakeClock(time.Now()), "operator-a")
+
+	require.NoError(t, a.LockContext(context.Background(), "lb-1"))
+	// another goroutine of the same identity must still wait
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, a.LockContext(ctx, "lb-1"), context.DeadlineExceeded)
+	require.NoError(t, a.TryUnlock("lb-1"))
+}
+
+func TestLeaseLockLostTakenOver(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	logger, hook := test.NewNullLogger()
+	a, err := NewLeaseLock(c, LeaseConfig{
+		Namespace: "default",
+		Identity:  "operator-a",
+		Clock:     fakeClock,
+		Log:       logrus.NewEntry(logger),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.LockContext(context.Background(), "lb-1"))
+	lost := a.Lost("lb-1")
+	lease := getLease(t, c, "lb-1")
+	lease.Spec.HolderIdentity = ptr.To("operator-b")
+	require.NoError(t, c.Update(context.Background(), lease))
+
+	assert.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	fakeClock.Step(DefaultRenewInterval)
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("the lease taken over was not reported as lost")
+	}
+	require.NotNil(t, hook.LastEntry())
+	assert.Equal(t, "lease was taken over by operator-b", hook.LastEntry().Message)
+	assert.Equal(t, "lb-1", hook.LastEntry().Data["lease"])
+
+	require.NoError(t, a.TryUnlock("lb-1"))
+	assert.Equal(t, "operator-b", ptr.Deref(getLease(t, c, "lb-1").Spec.HolderIdentity, ""), "the lease of another identity is not released")
+}
+
+func TestLeaseLockLostNotRenewed(t *testing.T) {
+	var failing atomic.Bool
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if failing.Load() {
+				return errors.New("connection refused")
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+	}).Build()
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC))
+	logger, hook := test.NewNullLogger()
+	a, err := NewLeaseLock(c, LeaseConfig{
+		Namespace:     "default",
+		Identity:      "operator-a",
+		LeaseDuration: 15 * time.Second,
+		RenewInterval: 5 * time.Second,
+		Clock:         fakeClock,
+		Log:           logrus.NewEntry(logger),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.LockContext(context.Background(), "lb-1"))
+	lost := a.Lost("lb-1")
+	failing.Store(true)
+	for i := 0; i < 2; i++ {
+		assert.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+		fakeClock.Step(5 * time.Second)
+		assert.Eventually(t, func() bool { return len(hook.AllEntries()) == i+1 }, time.Second, time.Millisecond)
+	}
+	select {
+	case <-lost:
+		t.Fatal("the lease is not lost before LeaseDuration")
+	default:
+	}
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+
+	fakeClock.Step(5 * time.Second)
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("the lease which could not be renewed was not reported as lost")
+	}
+	assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
+
+	failing.Store(false)
+	require.NoError(t, a.TryUnlock("lb-1"))
+}
+
+func TestLeaseLockLostOnUnlock(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	a := newTestLeaseLock(t, c, clocktesting.NewFakeClock(time.Now()), "operator-a")
+
+	select {
+	case <-a.Lost("lb-1"):
+	default:
+		t.Fatal("a key which is not locked is reported as lost")
+	}
+	require.NoError(t, a.LockContext(context.Background(), "lb-1"))
+	lost := a.Lost("lb-1")
+	select {
+	case <-lost:
+		t.Fatal("a held lease is not lost")
+	default:
+	}
+	require.NoError(t, a.TryUnlock("lb-1"))
+	select {
+	case <-lost:
+	default:
+		t.Fatal("an unlocked lease is reported as lost")
+	}
+}
+
+func TestLeaseLockRetriesTransientErrors(t *testing.T) {
+	var failures atomic.Int32
+	failures.Store(2)
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if failures.Add(-1) >= 0 {
+				return apierrors.NewTooManyRequests("throttled", 1)
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	}).Build()
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	a := newTestLeaseLock(t, c, fakeClock, "operator-a")
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- a.LockContext(context.Background(), "lb-1")
+	}()
+	for i := 0; i < 2; i++ {
+		assert.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+		fakeClock.Step(time.Second)
+	}
+	select {
+	case err := <-acquired:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the lease was not acquired after the transient errors")
+	}
+	require.NoError(t, a.TryUnlock("lb-1"))
+}
+
+func TestLeaseLockTerminalError(t *testing.T) {
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			return apierrors.NewForbidden(coordinationv1.Resource("leases"), key.Name, errors.New("no rbac"))
+		},
+	}).Build()
+	a := newTestLeaseLock(t, c, clocktesting.NewFakeClock(time.Now()), "operator-a")
+
+	err := a.LockContext(context.Background(), "lb-1")
+	assert.True(t, apierrors.IsForbidden(err))
+	var lockErr *LockError
+	assert.False(t, errors.As(err, &lockErr))
+	assert.True(t, a.local.TryLock("lb-1"), "the local lock is released")
+}
+
+func TestLeaseLockCancelledDuringRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := fake.NewClientBuilder().WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			cancel()
+			return ctx.Err()
+		},
+	}).Build()
+	a := newTestLeaseLock(t, c, clocktesting.NewFakeClock(time.Now()), "operator-a")
+
+	err := a.LockContext(ctx, "lb-1")
+	var lockErr *LockError
+	require.ErrorAs(t, err, &lockErr)
+	assert.ErrorIs(t, err, context.Canceled)
+	result, err := errs.HandleReconcileError(err, logrus.NewEntry(logrus.New()))
+	assert.NoError(t, err)
+	assert.True(t, result.Requeue)
+}
+
+func TestNewLeaseLockInvalid(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	_, err := NewLeaseLock(c, LeaseConfig{Namespace: "default"})
+	assert.Error(t, err)
+	_, err = NewLeaseLock(c, LeaseConfig{Namespace: "default", Identity: "a", LeaseDuration: time.Second, RenewInterval: time.Second})
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package multilock
+
+import (
+	"context"
+)
+
+// Locker is an exclusive lock per key. TypedMultiLock locks within the process,
+// LeaseLock locks across processes.
+type Locker[K comparable] interface {
+	// LockContext blocks until key is locked, or returns a *LockError once ctx is done.
+	LockContext(ctx context.Context, key K) error
+	// Unlock releases key, failures are ignored or logged.
+	Unlock(key K)
+	// TryUnlock releases key, it returns an error wrapping ErrNotLocked when key is not locked.
+	TryUnlock(key K) error
+}
+
+var (
+	_ Locker[interface{}] = &MultiLock{}
+	_ Locker[string]      = &TypedMultiLock[string]{}
+	_ Locker[string]      = &LeaseLock{}
+)
@@ -0,0 +1,175 @@
+package multilock
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/anngdinh/operator-helper/contexts/logid"
+)
+
+// Values of the mode label.
+const (
+	modeRead  = "read"
+	modeWrite = "write"
+)
+
+var (
+	waitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "multilock_wait_duration_seconds",
+		Help:    "Time spent waiting to acquire the lock of a key.",
+		Buckets: []float64{0.0001, 0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60},
+	}, []string{"lock", "mode"})
+	holdDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "multilock_hold_duration_seconds",
+		Help:    "Time the lock of a key was held.",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300},
+	}, []string{"lock", "mode"})
+	lockedKeys = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "multilock_locked_keys",
+		Help: "Number of keys currently locked.",
+	}, []string{"lock"})
+)
+
+// RegisterMetrics registers the metrics of the locks created WithMetrics with registerer, e.g. the
+// controller-runtime one with RegisterMetrics(metrics.Registry). It must be called once.
+func RegisterMetrics(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{waitDuration, holdDuration, lockedKeys} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithMetrics records the wait and hold time and the number of locked keys, with the lock label
+// set to name. The metrics are exposed once registered with RegisterMetrics.
+func WithMetrics(name string) Option {
+	return func(o *options) {
+		o.metricsName = name
+	}
+}
+
+type lockMetrics struct {
+	waitRead, waitWrite prometheus.Observer
+	holdRead, holdWrite prometheus.Observer
+	locked              prometheus.Gauge
+}
+
+func newLockMetrics(name string) *lockMetrics {
+	if name == "" {
+		return nil
+	}
+	return &lockMetrics{
+		waitRead:  waitDuration.WithLabelValues(name, modeRead),
+		waitWrite: waitDuration.WithLabelValues(name, modeWrite),
+		holdRead:  holdDuration.WithLabelValues(name, modeRead),
+		holdWrite: holdDuration.WithLabelValues(name, modeWrite),
+		locked:    lockedKeys.WithLabelValues(name),
+	}
+}
+
+// observeWait records the wait of a caller which started waiting at start. It's a no-op, which
+// doesn't read the time, when the metrics are disabled.
+func (m *lockMetrics) observeWait(writer bool, start time.Time) {
+	if m == nil {
+		return
+	}
+	if writer {
+		m.waitWrite.Observe(time.Since(start).Seconds())
+	} else {
+		m.waitRead.Observe(time.Since(start).Seconds())
+	}
+}
+
+// observeHold records the hold of a key locked since heldSince.
+func (m *lockMetrics) observeHold(writer bool, heldSince time.Time) {
+	if m == nil {
+		return
+	}
+	if writer {
+		m.holdWrite.Observe(time.Since(heldSince).Seconds())
+	} else {
+		m.holdRead.Observe(time.Since(heldSince).Seconds())
+	}
+}
+
+func (m *lockMetrics) addLocked(delta float64) {
+	if m == nil {
+		return
+	}
+	m.locked.Add(delta)
+}
+
+type holderKey struct{}
+
+// WithHolder returns a ctx labelling the locks taken with LockContext and RLockContext as held
+// by holder in Snapshot. Without it, the log ID of a contexts.ContextWrapper is used, even when
+// it was wrapped by another context, see logid.FromContext.
+// In debug mode, the label also identifies the holder whose lock order is tracked, so it must
+// never be used by concurrent goroutines, see WithDebug.
+func WithHolder(ctx context.Context, holder string) context.Context {
+	return context.WithValue(ctx, holderKey{}, holder)
+}
+
+func holderFromContext(ctx context.Context) string {
+	if holder := explicitHolder(ctx); holder != "" {
+		return holder
+	}
+	return logid.FromContext(ctx)
+}
+
+// explicitHolder returns the label set by WithHolder, the log ID is not used as it's shared by
+// the goroutines a ContextWrapper starts with Go.
+func explicitHolder(ctx context.Context) string {
+	holder, _ := ctx.Value(holderKey{}).(string)
+	return holder
+}
+
+// KeyState describes a locked key in a Snapshot.
+type KeyState[K comparable] struct {
+	Key     K
+	Readers int
+	Writers int
+	// Waiters is the number of callers waiting for the lock.
+	Waiters int
+	// HeldFor is how long the key has been locked without interruption.
+	HeldFor time.Duration
+	// Holder is the label of the first holder which had one since the key was locked, see
+	// WithHolder. The holders without a label don't change it. Readers keep it until the key is
+	// no longer read locked, even if the labelled reader already left.
+	Holder string
+}
+
+// Snapshot returns the state of every locked key, the longest held first.
+func (mLock *TypedMultiLock[K]) Snapshot() []KeyState[K] {
+	now := time.Now()
+	var states []KeyState[K]
+	for i := range mLock.shards {
+		sh := &mLock.shards[i]
+		sh.iLock.Lock()
+		for key, kl := range sh.inUse {
+			if !kl.held() {
+				continue
+			}
+			state := KeyState[K]{
+				Key:     key,
+				Readers: kl.readers,
+				HeldFor: now.Sub(kl.heldSince),
+				Holder:  kl.holder,
+			}
+			if kl.writer {
+				state.Writers = 1
+			}
+			state.Waiters = kl.counter - state.Readers - state.Writers
+			states = append(states, state)
+		}
+		sh.iLock.Unlock()
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].HeldFor > states[j].HeldFor
+	})
+	return states
+}
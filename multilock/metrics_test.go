@@ -0,0 +1,135 @@
+package multilock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anngdinh/operator-helper/contexts"
+)
+
+func sampleCount(t *testing.T, vec *prometheus.HistogramVec, labels ...string) uint64 {
+	t.Helper()
+	metric := &dto.Metric{}
+	require.NoError(t, vec.WithLabelValues(labels...).(prometheus.Histogram).Write(metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestMultiLockMetrics(t *testing.T) {
+	name := t.Name()
+	t.Cleanup(func() {
+		waitDuration.DeletePartialMatch(prometheus.Labels{"lock": name})
+		holdDuration.DeletePartialMatch(prometheus.Labels{"lock": name})
+		lockedKeys.DeletePartialMatch(prometheus.Labels{"lock": name})
+	})
+	locker := New[string](WithMetrics(name))
+
+	locker.Lock("lb-1")
+	locker.RLock("lb-2")
+	locker.RLock("lb-2")
+	assert.False(t, locker.TryLock("lb-1"))
+	assert.Equal(t, float64(2), testutil.ToFloat64(lockedKeys.WithLabelValues(name)))
+	assert.Equal(t, uint64(1), sampleCount(t, waitDuration, name, modeWrite), "a failed attempt is not recorded")
+	assert.Equal(t, uint64(2), sampleCount(t, waitDuration, name, modeRead))
+
+	require.NoError(t, locker.TryUnlock("lb-1"))
+	require.NoError(t, locker.TryRUnlock("lb-2"))
+	assert.Equal(t, float64(1), testutil.ToFloat64(lockedKeys.WithLabelValues(name)))
+	assert.Equal(t, uint64(1), sampleCount(t, holdDuration, name, modeWrite))
+	assert.Equal(t, uint64(0), sampleCount(t, holdDuration, name, modeRead), "the key is still read locked")
+
+	require.NoError(t, locker.TryRUnlock("lb-2"))
+	assert.Error(t, locker.TryRUnlock("lb-2"))
+	assert.Equal(t, float64(0), testutil.ToFloat64(lockedKeys.WithLabelValues(name)))
+	assert.Equal(t, uint64(1), sampleCount(t, holdDuration, name, modeRead))
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, RegisterMetrics(registry))
+	assert.Error(t, RegisterMetrics(registry), "the metrics are registered once")
+
+	name := t.Name()
+	t.Cleanup(func() {
+		waitDuration.DeletePartialMatch(prometheus.Labels{"lock": name})
+		holdDuration.DeletePartialMatch(prometheus.Labels{"lock": name})
+		lockedKeys.DeletePartialMatch(prometheus.Labels{"lock": name})
+	})
+	locker := New[string](WithMetrics(name))
+	locker.Lock("lb-1")
+	locker.Unlock("lb-1")
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	var names []string
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	assert.ElementsMatch(t, []string{"multilock_wait_duration_seconds", "multilock_hold_duration_seconds", "multilock_locked_keys"}, names)
+}
+
+func TestSnapshotFirstHolder(t *testing.T) {
+	locker := New[string]()
+	locker.Lock("lb-1")
+	require.NoError(t, locker.TryUnlock("lb-1"))
+
+	require.NoError(t, locker.RLockContext(WithHolder(context.Background(), "reconcile-1"), "lb-1"))
+	require.NoError(t, locker.RLockContext(WithHolder(context.Background(), "reconcile-2"), "lb-1"))
+	states := locker.Snapshot()
+	require.Len(t, states, 1)
+	assert.Equal(t, "reconcile-1", states[0].Holder, "a later holder doesn't overwrite the label")
+
+	locker.RUnlock("lb-1")
+	locker.RUnlock("lb-1")
+	require.NoError(t, locker.LockContext(WithHolder(context.Background(), "reconcile-3"), "lb-1"))
+	assert.Equal(t, "reconcile-3", locker.Snapshot()[0].Holder, "the label is reset once the key is released")
+	locker.Unlock("lb-1")
+}
+
+func TestSnapshot(t *testing.T) {
+	locker := NewMultipleLock(WithShards(4))
+	assert.Empty(t, locker.Snapshot())
+
+	require.NoError(t, locker.LockContext(WithHolder(context.Background(), "reconcile-lb-1"), "lb-1"))
+	time.Sleep(10 * time.Millisecond)
+	logCtx := contexts.NewContext(context.Background())
+	timeoutCtx, cancel := context.WithTimeout(logCtx, time.Minute)
+	defer cancel()
+	require.NoError(t, locker.RLockContext(timeoutCtx, "lb-2"))
+	locker.RLock("lb-2")
+
+	waiting := make(chan struct{})
+	go func() {
+		locker.Lock("lb-1")
+		close(waiting)
+	}()
+	waitFor(t, func() bool { return counter(locker, "lb-1") == 2 })
+
+	states := locker.Snapshot()
+	require.Len(t, states, 2)
+	assert.Equal(t, "lb-1", states[0].Key)
+	assert.Equal(t, 1, states[0].Writers)
+	assert.Equal(t, 0, states[0].Readers)
+	assert.Equal(t, 1, states[0].Waiters)
+	assert.Equal(t, "reconcile-lb-1", states[0].Holder)
+	assert.GreaterOrEqual(t, states[0].HeldFor, 10*time.Millisecond)
+	assert.Greater(t, states[0].HeldFor, states[1].HeldFor)
+
+	assert.Equal(t, "lb-2", states[1].Key)
+	assert.Equal(t, 2, states[1].Readers)
+	assert.Equal(t, 0, states[1].Waiters)
+	assert.Equal(t, logCtx.GetLogId(), states[1].Holder, "the reader without a label doesn't clear it")
+
+	require.NoError(t, locker.TryUnlock("lb-1"))
+	<-waiting
+	require.NoError(t, locker.TryUnlock("lb-1"))
+	require.NoError(t, locker.TryRUnlock("lb-2"))
+	require.NoError(t, locker.TryRUnlock("lb-2"))
+	assert.Empty(t, locker.Snapshot())
+}
@@ -1,84 +1,326 @@
 package multilock
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
 	"sync"
+	"time"
 )
 
+// ErrNotLocked is returned by TryUnlock and TryRUnlock when the key is not held in that mode.
+var ErrNotLocked = errors.New("key is not locked")
+
+// errBusy is returned by lock when the key is locked and the caller doesn't wait.
+var errBusy = errors.New("key is busy")
+
+type options struct {
+	debug       bool
+	shards      int
+	metricsName string
+}
+
+type Option func(*options)
+
+// WithDebug makes Unlock and RUnlock panic on misuse instead of ignoring it, and
+// makes LockContext and RLockContext panic with ErrLockOrderInversion when two keys are locked
+// in both orders by holders labelled with WithHolder, the log ID of the context is not enough.
+// A label must never be used by concurrent goroutines, their locks would be mixed up.
+// It's meant for tests as tracking the order is slow.
+func WithDebug() Option {
+	return func(o *options) {
+		o.debug = true
+	}
+}
+
+// WithShards spreads the keys over n shards, each with its own internal mutex, so many workers
+// locking different keys don't contend on a single mutex. It costs a hash of the key per call,
+// so it only pays off with many concurrent callers. The default is a single shard.
+func WithShards(n int) Option {
+	return func(o *options) {
+		o.shards = n
+	}
+}
+
+// MultiLock is a TypedMultiLock accepting any comparable key, kept for compatibility.
+// Prefer New with the key type, so keys of different types can't silently get different locks.
 type MultiLock struct {
-	inUse sync.Map
-	pool  *sync.Pool
+	*TypedMultiLock[interface{}]
+}
+
+func NewMultipleLock(opts ...Option) *MultiLock {
+	return &MultiLock{New[interface{}](opts...)}
+}
+
+// TypedMultiLock is a set of reader/writer locks, one per key of type K.
+type TypedMultiLock[K comparable] struct {
+	shards  []shard[K]
+	seed    maphash.Seed
+	pool    *sync.Pool
+	debug   bool
+	metrics *lockMetrics
+	order   *orderDetector[K]
+}
+
+// shard holds the locks of the keys hashed to it, padded to a cache line so neighbour shards
+// don't contend on it.
+type shard[K comparable] struct {
 	iLock sync.Mutex
+	inUse map[K]*keyLock
+	_     [48]byte
 }
 
+// keyLock is the lock of a key, it goes back to the pool once counter drops to zero.
+// All the fields are guarded by the iLock of its shard. Unlike a sync.RWMutex, a caller waiting
+// for it can give up and leave, see lock.
 type keyLock struct {
+	// counter is the number of holders and waiters
 	counter int
-	lock    *sync.RWMutex
+	readers int
+	writer  bool
+	// writersWaiting keeps new readers out while writers wait, so they are not starved
+	writersWaiting int
+	// released is closed when the lock is released, to wake up the waiters. It's only made
+	// once someone waits.
+	released chan struct{}
+	// heldSince is when the key was locked, while readers or writer are set. It's recorded
+	// even without metrics for Snapshot, but only once per locked period.
+	heldSince time.Time
+	// holder is the first label of the holders, see KeyState.Holder
+	holder string
 }
 
-func NewMultipleLock() *MultiLock {
-	return &MultiLock{
+func (kl *keyLock) held() bool {
+	return kl.writer || kl.readers > 0
+}
+
+// free reports whether the lock can be taken for writing or reading.
+func (kl *keyLock) free(writer bool) bool {
+	if writer {
+		return !kl.held()
+	}
+	return !kl.writer && kl.writersWaiting == 0
+}
+
+// wake wakes up the callers waiting for the lock.
+func (kl *keyLock) wake() {
+	if kl.released != nil {
+		close(kl.released)
+		kl.released = nil
+	}
+}
+
+func New[K comparable](opts ...Option) *TypedMultiLock[K] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.shards < 1 {
+		o.shards = 1
+	}
+	mLock := &TypedMultiLock[K]{
+		shards: make([]shard[K], o.shards),
+		seed:   maphash.MakeSeed(),
 		pool: &sync.Pool{
 			New: func() interface{} {
-				return &sync.RWMutex{}
+				return &keyLock{}
 			},
 		},
+		debug:   o.debug,
+		metrics: newLockMetrics(o.metricsName),
+	}
+	if o.debug {
+		mLock.order = newOrderDetector[K]()
 	}
+	for i := range mLock.shards {
+		mLock.shards[i].inUse = map[K]*keyLock{}
+	}
+	return mLock
 }
 
-func (mLock *MultiLock) Lock(key interface{}) {
-	lock := mLock.acquireLock(key)
-	lock.Lock()
+func (mLock *TypedMultiLock[K]) Lock(key K) {
+	_ = mLock.lock(context.Background(), key, true, true)
 }
 
-func (mLock *MultiLock) Unlock(key interface{}) {
-	lock := mLock.releaseLock(key)
-	if lock != nil {
-		lock.Unlock()
-	}
+// Unlock releases key locked for writing. Unlocking a key which is not locked for writing is
+// ignored, or panics in debug mode, see TryUnlock to get an error instead.
+func (mLock *TypedMultiLock[K]) Unlock(key K) {
+	mLock.checkMisuse(mLock.releaseLock(key, true))
 }
 
-func (mLock *MultiLock) RLock(key interface{}) {
-	lock := mLock.acquireLock(key)
-	lock.RLock()
+// TryUnlock is like Unlock but returns an error wrapping ErrNotLocked when key is not locked
+// for writing, even in debug mode.
+func (mLock *TypedMultiLock[K]) TryUnlock(key K) error {
+	return mLock.releaseLock(key, true)
 }
 
-func (mLock *MultiLock) RUnlock(key interface{}) {
-	lock := mLock.releaseLock(key)
-	if lock != nil {
-		lock.RUnlock()
-	}
+func (mLock *TypedMultiLock[K]) RLock(key K) {
+	_ = mLock.lock(context.Background(), key, false, true)
 }
 
-func (mLock *MultiLock) getLock(key interface{}) *keyLock {
-	locker, _ := mLock.inUse.LoadOrStore(
-		key,
-		&keyLock{
-			lock: mLock.pool.Get().(*sync.RWMutex),
-		},
-	)
-	return locker.(*keyLock)
+// RUnlock releases key locked for reading. Unlocking a key which is not locked for reading is
+// ignored, or panics in debug mode, see TryRUnlock to get an error instead.
+func (mLock *TypedMultiLock[K]) RUnlock(key K) {
+	mLock.checkMisuse(mLock.releaseLock(key, false))
+}
+
+// TryRUnlock is like RUnlock but returns an error wrapping ErrNotLocked when key is not locked
+// for reading, even in debug mode.
+func (mLock *TypedMultiLock[K]) TryRUnlock(key K) error {
+	return mLock.releaseLock(key, false)
 }
 
-func (mLock *MultiLock) acquireLock(key interface{}) *sync.RWMutex {
-	mLock.iLock.Lock()
-	kl := mLock.getLock(key)
+// TryLock locks key only if it's free, and reports whether it did.
+func (mLock *TypedMultiLock[K]) TryLock(key K) bool {
+	return mLock.lock(context.Background(), key, true, false) == nil
+}
+
+// TryRLock locks key for reading only if it's not locked for writing, and reports whether it did.
+func (mLock *TypedMultiLock[K]) TryRLock(key K) bool {
+	return mLock.lock(context.Background(), key, false, false) == nil
+}
+
+func (mLock *TypedMultiLock[K]) shard(key K) *shard[K] {
+	if len(mLock.shards) == 1 {
+		return &mLock.shards[0]
+	}
+	return &mLock.shards[maphash.Comparable(mLock.seed, key)%uint64(len(mLock.shards))]
+}
+
+// lock locks key for writing or reading. When the lock is taken, it returns errBusy unless wait
+// is set, then it waits until the lock is released or ctx is done. A caller giving up stops
+// counting as a waiter right away, so nothing is left behind.
+func (mLock *TypedMultiLock[K]) lock(ctx context.Context, key K, writer, wait bool) error {
+	var start time.Time
+	if mLock.metrics != nil {
+		start = time.Now()
+	}
+	sh := mLock.shard(key)
+	sh.iLock.Lock()
+	defer sh.iLock.Unlock()
+	kl, ok := sh.inUse[key]
+	if !ok {
+		kl = mLock.pool.Get().(*keyLock)
+		sh.inUse[key] = kl
+	}
 	kl.counter++
-	mLock.iLock.Unlock()
-	return kl.lock
+
+	if !kl.free(writer) {
+		if !wait {
+			mLock.releaseRef(sh, key, kl)
+			return errBusy
+		}
+		if writer {
+			kl.writersWaiting++
+		}
+		for !kl.free(writer) && ctx.Err() == nil {
+			if kl.released == nil {
+				kl.released = make(chan struct{})
+			}
+			released := kl.released
+			sh.iLock.Unlock()
+			select {
+			case <-released:
+			case <-ctx.Done():
+			}
+			sh.iLock.Lock()
+		}
+		if writer {
+			kl.writersWaiting--
+		}
+		if !kl.free(writer) {
+			if writer && kl.writersWaiting == 0 {
+				// the readers kept out by this writer can go on
+				kl.wake()
+			}
+			mLock.releaseRef(sh, key, kl)
+			return &LockError{Key: key, Err: ctx.Err()}
+		}
+	}
+
+	if !kl.held() {
+		kl.heldSince = time.Now()
+		mLock.metrics.addLocked(1)
+	}
+	if writer {
+		kl.writer = true
+	} else {
+		kl.readers++
+	}
+	if kl.holder == "" {
+		kl.holder = holderFromContext(ctx)
+	}
+	mLock.metrics.observeWait(writer, start)
+	if mLock.order != nil && writer {
+		mLock.order.acquired(explicitHolder(ctx), key)
+	}
+	return nil
 }
 
-func (mLock *MultiLock) releaseLock(key interface{}) *sync.RWMutex {
-	mLock.iLock.Lock()
-	kl := mLock.getLock(key)
-	kl.counter--
-	shouldUnlock := kl.counter >= 0
-	if kl.counter <= 0 {
-		mLock.pool.Put(kl.lock)
-		mLock.inUse.Delete(key)
+func (mLock *TypedMultiLock[K]) releaseLock(key K, writer bool) error {
+	sh := mLock.shard(key)
+	sh.iLock.Lock()
+	defer sh.iLock.Unlock()
+	kl, ok := sh.inUse[key]
+	if !ok {
+		return mLock.misuse(key, writer)
+	}
+	if writer {
+		if !kl.writer {
+			return mLock.misuse(key, writer)
+		}
+		kl.writer = false
+	} else {
+		if kl.readers == 0 {
+			return mLock.misuse(key, writer)
+		}
+		kl.readers--
+	}
+	if !kl.held() {
+		mLock.metrics.observeHold(writer, kl.heldSince)
+		mLock.metrics.addLocked(-1)
+		kl.holder = ""
+		kl.wake()
 	}
-	mLock.iLock.Unlock()
-	if shouldUnlock {
-		return kl.lock
+	mLock.releaseRef(sh, key, kl)
+	if mLock.order != nil && writer {
+		mLock.order.released(key)
 	}
 	return nil
 }
+
+// releaseRef recycles the lock once it has no holder and no waiter, the iLock of sh must be held.
+func (mLock *TypedMultiLock[K]) releaseRef(sh *shard[K], key K, kl *keyLock) {
+	kl.counter--
+	if kl.counter == 0 {
+		delete(sh.inUse, key)
+		*kl = keyLock{}
+		mLock.pool.Put(kl)
+	}
+}
+
+func (mLock *TypedMultiLock[K]) misuse(key K, writer bool) error {
+	op := "RUnlock"
+	if writer {
+		op = "Unlock"
+	}
+	return fmt.Errorf("%s of %v: %w", op, key, ErrNotLocked)
+}
+
+// checkMisuse panics with err in debug mode.
+func (mLock *TypedMultiLock[K]) checkMisuse(err error) {
+	if err != nil && mLock.debug {
+		panic(err)
+	}
+}
+
+// checkOrder panics in debug mode when waiting for key inverts the order of a previous lock.
+func (mLock *TypedMultiLock[K]) checkOrder(ctx context.Context, key K) {
+	if mLock.order == nil {
+		return
+	}
+	if err := mLock.order.check(explicitHolder(ctx), key); err != nil {
+		panic(err)
+	}
+}
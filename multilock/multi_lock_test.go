@@ -1,8 +1,12 @@
 package multilock
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -139,3 +143,299 @@ func TestMultiLockWithNonStringKey(t *testing.T) {
 	}()
 	<-unlocked
 }
+
+func TestMultiLockTryLock(t *testing.T) {
+	locker := NewMultipleLock()
+
+	if !locker.TryLock("key") {
+		t.Fatalf("TryLock on a free key should succeed")
+	}
+	if locker.TryLock("key") || locker.TryRLock("key") {
+		t.Fatalf("TryLock and TryRLock on a locked key should fail")
+	}
+	if counter(locker, "key") != 1 {
+		t.Fatalf("Expected counter 1 after failed attempts, got %d", counter(locker, "key"))
+	}
+	locker.Unlock("key")
+	if counter(locker, "key") != 0 {
+		t.Fatalf("Expected key to be released after Unlock")
+	}
+
+	if !locker.TryRLock("key") || !locker.TryRLock("key") {
+		t.Fatalf("TryRLock should be shared between readers")
+	}
+	if locker.TryLock("key") {
+		t.Fatalf("TryLock on a key locked for reading should fail")
+	}
+	locker.RUnlock("key")
+	locker.RUnlock("key")
+	if counter(locker, "key") != 0 {
+		t.Fatalf("Expected key to be released after RUnlock")
+	}
+}
+
+func TestMultiLockTryLockConcurrent(t *testing.T) {
+	locker := NewMultipleLock()
+	var wg sync.WaitGroup
+	var holders, maxHolders, acquired atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if !locker.TryLock("key") {
+					continue
+				}
+				acquired.Add(1)
+				current := holders.Add(1)
+				for {
+					seen := maxHolders.Load()
+					if current <= seen || maxHolders.CompareAndSwap(seen, current) {
+						break
+					}
+				}
+				runtime.Gosched()
+				holders.Add(-1)
+				locker.Unlock("key")
+			}
+		}()
+	}
+	wg.Wait()
+	if acquired.Load() == 0 {
+		t.Fatalf("Expected TryLock to succeed at least once")
+	}
+	if maxHolders.Load() != 1 {
+		t.Fatalf("Expected a single holder at a time, got up to %d", maxHolders.Load())
+	}
+	if counter(locker, "key") != 0 {
+		t.Fatalf("Expected key to be released")
+	}
+}
+
+func TestMultiLockMisuse(t *testing.T) {
+	locker := NewMultipleLock()
+
+	if err := locker.TryUnlock("key"); !errors.Is(err, ErrNotLocked) {
+		t.Fatalf("Expected ErrNotLocked when unlocking an unheld key, got %v", err)
+	}
+	if counter(locker, "key") != 0 {
+		t.Fatalf("Unlocking an unheld key should not create an entry")
+	}
+	// without debug mode, the misuse is ignored
+	locker.Unlock("key")
+	locker.RUnlock("key")
+
+	locker.Lock("key")
+	if err := locker.TryRUnlock("key"); !errors.Is(err, ErrNotLocked) {
+		t.Fatalf("Expected ErrNotLocked on RUnlock of a write locked key, got %v", err)
+	}
+	if locker.TryLock("key") {
+		t.Fatalf("A failed RUnlock should not release the write lock")
+	}
+	if err := locker.TryUnlock("key"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	locker.RLock("key")
+	if err := locker.TryUnlock("key"); !errors.Is(err, ErrNotLocked) {
+		t.Fatalf("Expected ErrNotLocked on Unlock of a read locked key, got %v", err)
+	}
+	if err := locker.TryRUnlock("key"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if counter(locker, "key") != 0 {
+		t.Fatalf("Expected key to be released")
+	}
+}
+
+func TestMultiLockDebugPanics(t *testing.T) {
+	locker := NewMultipleLock(WithDebug())
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || !errors.Is(err, ErrNotLocked) {
+			t.Fatalf("Expected a panic with ErrNotLocked in debug mode, got %v", r)
+		}
+	}()
+	locker.RUnlock("key")
+}
+
+func TestMultiLockWriterWaitingBehindReaders(t *testing.T) {
+	locker := NewMultipleLock()
+	locker.RLock("key")
+	locker.RLock("key")
+
+	acquired := make(chan struct{})
+	go func() {
+		locker.Lock("key")
+		close(acquired)
+	}()
+	waitFor(t, func() bool { return counter(locker, "key") == 3 })
+
+	locker.RUnlock("key")
+	locker.RUnlock("key")
+	<-acquired
+	// the lock must not have been recycled while the writer was waiting
+	if counter(locker, "key") != 1 {
+		t.Fatalf("Expected the writer to still reference the lock, got counter %d", counter(locker, "key"))
+	}
+	if locker.TryRLock("key") {
+		t.Fatalf("Expected the writer to hold the lock")
+	}
+	if err := locker.TryUnlock("key"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if counter(locker, "key") != 0 {
+		t.Fatalf("Expected key to be released")
+	}
+}
+
+func TestMultiLockStress(t *testing.T) {
+	locker := NewMultipleLock()
+	keys := []string{"key1", "key2", "key3"}
+	var mu sync.Mutex
+	readers := map[string]int{}
+	writers := map[string]int{}
+
+	check := func(key string, writer bool, delta int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if writer {
+			writers[key] += delta
+		} else {
+			readers[key] += delta
+		}
+		if writers[key] > 1 || (writers[key] == 1 && readers[key] > 0) {
+			t.Errorf("Key %s held by %d writers and %d readers", key, writers[key], readers[key])
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 300; j++ {
+				key := keys[(i+j)%len(keys)]
+				switch (i + j) % 5 {
+				case 0:
+					locker.Lock(key)
+					check(key, true, 1)
+					check(key, true, -1)
+					if err := locker.TryUnlock(key); err != nil {
+						t.Error(err)
+					}
+				case 1:
+					locker.RLock(key)
+					check(key, false, 1)
+					check(key, false, -1)
+					if err := locker.TryRUnlock(key); err != nil {
+						t.Error(err)
+					}
+				case 2:
+					if locker.TryLock(key) {
+						check(key, true, 1)
+						check(key, true, -1)
+						if err := locker.TryUnlock(key); err != nil {
+							t.Error(err)
+						}
+					}
+				case 3:
+					if locker.TryRLock(key) {
+						check(key, false, 1)
+						check(key, false, -1)
+						if err := locker.TryRUnlock(key); err != nil {
+							t.Error(err)
+						}
+					}
+				case 4:
+					ctx, cancel := context.WithTimeout(context.Background(), time.Microsecond)
+					if locker.LockContext(ctx, key) == nil {
+						check(key, true, 1)
+						check(key, true, -1)
+						if err := locker.TryUnlock(key); err != nil {
+							t.Error(err)
+						}
+					}
+					cancel()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// the LockContext callers which gave up left nothing behind
+	for _, key := range keys {
+		if counter(locker, key) != 0 {
+			t.Errorf("Expected key %s to be released, got counter %d", key, counter(locker, key))
+		}
+	}
+}
+
+func counter(locker *MultiLock, key interface{}) int {
+	sh := locker.shard(key)
+	sh.iLock.Lock()
+	defer sh.iLock.Unlock()
+	kl, ok := sh.inUse[key]
+	if !ok {
+		return 0
+	}
+	return kl.counter
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTypedMultiLock(t *testing.T) {
+	type namespacedName struct{ namespace, name string }
+	locker := New[namespacedName]()
+	key := namespacedName{"default", "lb"}
+
+	locker.Lock(key)
+	if locker.TryLock(namespacedName{"default", "lb"}) {
+		t.Fatalf("Equal keys should share the same lock")
+	}
+	if !locker.TryLock(namespacedName{"default", "pool"}) {
+		t.Fatalf("Different keys should not share a lock")
+	}
+	if err := locker.TryUnlock(namespacedName{"default", "pool"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := locker.TryUnlock(key); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count := countKeys(locker); count != 0 {
+		t.Fatalf("Expected all keys to be released, got %d", count)
+	}
+}
+
+func TestMultiLockShards(t *testing.T) {
+	for _, shards := range []int{0, 1, 8} {
+		locker := New[int](WithShards(shards))
+		if shards > 1 && len(locker.shards) != shards {
+			t.Fatalf("Expected %d shards, got %d", shards, len(locker.shards))
+		}
+		for i := 0; i < 100; i++ {
+			locker.Lock(i)
+		}
+		for i := 0; i < 100; i++ {
+			if locker.TryRLock(i) {
+				t.Fatalf("Key %d should be locked", i)
+			}
+			if err := locker.TryUnlock(i); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if count := countKeys(locker); count != 0 {
+			t.Fatalf("Expected all keys to be released, got %d", count)
+		}
+	}
+}
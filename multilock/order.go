@@ -0,0 +1,173 @@
+package multilock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"sort"
+	"sync"
+)
+
+// ErrLockOrderInversion is reported in debug mode when two keys are locked in both orders,
+// which can deadlock.
+var ErrLockOrderInversion = errors.New("lock order inversion")
+
+// LockAll locks every key for writing in a deterministic order, so callers locking overlapping
+// sets of keys can't deadlock each other. Duplicated keys are locked once.
+func (mLock *TypedMultiLock[K]) LockAll(keys ...K) {
+	for _, key := range mLock.sortKeys(keys) {
+		mLock.Lock(key)
+	}
+}
+
+// LockAllContext is like LockAll but gives up when ctx is done. It's all or nothing: on error,
+// the keys already locked are unlocked.
+func (mLock *TypedMultiLock[K]) LockAllContext(ctx context.Context, keys ...K) error {
+	sorted := mLock.sortKeys(keys)
+	for i, key := range sorted {
+		if err := mLock.LockContext(ctx, key); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				mLock.Unlock(sorted[j])
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// UnlockAll unlocks the keys locked by LockAll or LockAllContext, in the reverse order.
+func (mLock *TypedMultiLock[K]) UnlockAll(keys ...K) error {
+	sorted := mLock.sortKeys(keys)
+	var errs []error
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if err := mLock.TryUnlock(sorted[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sortKeys returns the distinct keys ordered by their hash, then by their Go representation
+// in the rare case of a collision. The hash seed is random, so the order is only the same for
+// this TypedMultiLock, which is enough as its keys are only locked through it.
+func (mLock *TypedMultiLock[K]) sortKeys(keys []K) []K {
+	type hashedKey struct {
+		key  K
+		hash uint64
+	}
+	seen := make(map[K]struct{}, len(keys))
+	hashed := make([]hashedKey, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		hashed = append(hashed, hashedKey{key: key, hash: maphash.Comparable(mLock.seed, key)})
+	}
+	sort.Slice(hashed, func(i, j int) bool {
+		if hashed[i].hash != hashed[j].hash {
+			return hashed[i].hash < hashed[j].hash
+		}
+		return fmt.Sprintf("%#v", hashed[i].key) < fmt.Sprintf("%#v", hashed[j].key)
+	})
+	sorted := make([]K, len(hashed))
+	for i := range hashed {
+		sorted[i] = hashed[i].key
+	}
+	return sorted
+}
+
+// maxLockOrders bounds the orders remembered by an orderDetector, so a debug lock used with
+// ever new keys doesn't grow forever. Beyond it, arbitrary orders are forgotten.
+const maxLockOrders = 10000
+
+// orderDetector records the order in which every holder locks the keys for writing, and reports
+// a key locked before another one which is also locked before it elsewhere. The holders are
+// identified by the label of WithHolder, so only the locks taken with a labelled context are
+// tracked, and a label must not be shared by concurrent goroutines. The read locks are checked against the keys held but not tracked, as RUnlock
+// can't tell which reader left.
+type orderDetector[K comparable] struct {
+	mutex sync.Mutex
+	// held lists the keys locked by each holder, by label
+	held map[string][]K
+	// owners is the label of the holder of each tracked key
+	owners map[K]string
+	// before is the set of the observed orders, key a locked before key b
+	before map[[2]K]struct{}
+}
+
+func newOrderDetector[K comparable]() *orderDetector[K] {
+	return &orderDetector[K]{
+		held:   map[string][]K{},
+		owners: map[K]string{},
+		before: map[[2]K]struct{}{},
+	}
+}
+
+// check records that holder is about to wait for key, and returns an error wrapping
+// ErrLockOrderInversion when a key it holds was locked after key before.
+func (d *orderDetector[K]) check(holder string, key K) error {
+	if holder == "" {
+		return nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, heldKey := range d.held[holder] {
+		if heldKey == key {
+			continue
+		}
+		if _, ok := d.before[[2]K{key, heldKey}]; ok {
+			return fmt.Errorf("%w: %v locked by %s while holding %v, which was locked after it before", ErrLockOrderInversion, key, holder, heldKey)
+		}
+		d.remember([2]K{heldKey, key})
+	}
+	return nil
+}
+
+func (d *orderDetector[K]) remember(order [2]K) {
+	if _, ok := d.before[order]; ok {
+		return
+	}
+	if len(d.before) >= maxLockOrders {
+		for forgotten := range d.before {
+			delete(d.before, forgotten)
+			break
+		}
+	}
+	d.before[order] = struct{}{}
+}
+
+// acquired records that holder locked key for writing.
+func (d *orderDetector[K]) acquired(holder string, key K) {
+	if holder == "" {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.held[holder] = append(d.held[holder], key)
+	d.owners[key] = holder
+}
+
+// released forgets key for the holder which locked it for writing, whichever goroutine unlocks it.
+func (d *orderDetector[K]) released(key K) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	holder, ok := d.owners[key]
+	if !ok {
+		return
+	}
+	delete(d.owners, key)
+	keys := d.held[holder]
+	for i := len(keys) - 1; i >= 0; i-- {
+		if keys[i] == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(d.held, holder)
+	} else {
+		d.held[holder] = keys
+	}
+}
@@ -0,0 +1,182 @@
+package multilock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anngdinh/operator-helper/contexts"
+)
+
+func TestLockAllNoDeadlock(t *testing.T) {
+	locker := New[string](WithShards(4), WithDebug())
+	sets := [][]string{
+		{"lb", "listener-1", "listener-2"},
+		{"listener-2", "listener-1", "lb"},
+		{"listener-1", "lb"},
+		{"listener-2", "pool", "lb", "lb"},
+	}
+	var mu sync.Mutex
+	holders := map[string]int{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int, keys []string) {
+			defer wg.Done()
+			ctx := WithHolder(context.Background(), fmt.Sprint("reconcile-", i))
+			for j := 0; j < 200; j++ {
+				if err := locker.LockAllContext(ctx, keys...); err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				for _, key := range locker.sortKeys(keys) {
+					holders[key]++
+					if holders[key] != 1 {
+						t.Errorf("Key %s held %d times", key, holders[key])
+					}
+				}
+				for _, key := range locker.sortKeys(keys) {
+					holders[key]--
+				}
+				mu.Unlock()
+				if err := locker.UnlockAll(keys...); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i, sets[i%len(sets)])
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("LockAll deadlocked")
+	}
+	assert.Equal(t, 0, countKeys(locker))
+}
+
+func TestLockAllContextAllOrNothing(t *testing.T) {
+	locker := New[string]()
+	locker.Lock("listener-1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := locker.LockAllContext(ctx, "lb", "listener-1", "listener-2", "pool")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	for _, key := range []string{"lb", "listener-2", "pool"} {
+		assert.True(t, locker.TryLock(key), "key %s should have been unlocked", key)
+		require.NoError(t, locker.TryUnlock(key))
+	}
+
+	require.NoError(t, locker.TryUnlock("listener-1"))
+	require.NoError(t, locker.LockAllContext(context.Background(), "lb", "listener-1", "lb"))
+	assert.False(t, locker.TryRLock("lb"))
+	require.NoError(t, locker.UnlockAll("listener-1", "lb"))
+	// the abandoned waiter of listener-1 releases its reference in the background
+	assert.Eventually(t, func() bool { return countKeys(locker) == 0 }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, locker.UnlockAll("lb", "pool"), ErrNotLocked)
+}
+
+func TestSortKeysDeterministic(t *testing.T) {
+	locker := New[string]()
+	sorted := locker.sortKeys([]string{"c", "a", "b", "a"})
+	assert.Len(t, sorted, 3)
+	assert.Equal(t, sorted, locker.sortKeys([]string{"b", "c", "a"}))
+}
+
+func TestLockOrderInversion(t *testing.T) {
+	locker := New[string](WithDebug())
+	first := WithHolder(context.Background(), "reconcile-1")
+	second := WithHolder(context.Background(), "reconcile-2")
+
+	require.NoError(t, locker.LockContext(first, "lb"))
+	require.NoError(t, locker.LockContext(first, "listener-1"))
+	// a key unlocked by another goroutine is forgotten for its holder
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		locker.Unlock("listener-1")
+	}()
+	<-done
+	require.NoError(t, locker.TryUnlock("lb"))
+
+	// the holders without a label are not tracked
+	locker.Lock("listener-1")
+	locker.Lock("lb")
+	locker.Unlock("lb")
+	locker.Unlock("listener-1")
+
+	require.NoError(t, locker.LockContext(second, "listener-1"))
+	defer locker.Unlock("listener-1")
+	err := func() (err error) {
+		defer func() {
+			err, _ = recover().(error)
+		}()
+		_ = locker.RLockContext(second, "lb")
+		return nil
+	}()
+	require.Error(t, err, "expected a panic")
+	assert.ErrorIs(t, err, ErrLockOrderInversion)
+	assert.Contains(t, err.Error(), "reconcile-2")
+	assert.Equal(t, 1, countKeys(locker))
+}
+
+func TestLockOrderFanOutSharingLogId(t *testing.T) {
+	locker := New[string](WithDebug())
+	// the goroutines started by Go share the log ID of ctx, each locks a single key at a time
+	ctx := contexts.AsGroup(contexts.NewContext(context.Background()))
+	aLocked := make(chan struct{})
+	aNext, bNext := make(chan struct{}), make(chan struct{})
+	ctx.Go("a", func(child contexts.ContextWrapper) error {
+		require.NoError(t, locker.LockContext(child, "lb"))
+		close(aLocked)
+		<-aNext
+		locker.Unlock("lb")
+		require.NoError(t, locker.LockContext(child, "listener"))
+		close(bNext)
+		<-aNext
+		locker.Unlock("listener")
+		return nil
+	})
+	ctx.Go("b", func(child contexts.ContextWrapper) error {
+		<-aLocked
+		require.NoError(t, locker.LockContext(child, "listener"))
+		locker.Unlock("listener")
+		aNext <- struct{}{}
+		<-bNext
+		locked := false
+		assert.NotPanics(t, func() {
+			locked = locker.LockContext(child, "lb") == nil
+		}, "no goroutine held two keys")
+		if locked {
+			locker.Unlock("lb")
+		}
+		aNext <- struct{}{}
+		return nil
+	})
+	require.NoError(t, ctx.Wait())
+	assert.Equal(t, 0, countKeys(locker))
+}
+
+func TestLockOrderDetectorBounded(t *testing.T) {
+	detector := newOrderDetector[int]()
+	detector.acquired("reconcile-1", -1)
+	for i := 0; i < maxLockOrders+10; i++ {
+		require.NoError(t, detector.check("reconcile-1", i))
+	}
+	assert.Len(t, detector.before, maxLockOrders)
+	detector.released(-1)
+	assert.Empty(t, detector.held)
+	assert.Empty(t, detector.owners)
+}
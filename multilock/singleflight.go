@@ -0,0 +1,185 @@
+package multilock
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// SingleFlightConfig configures a SingleFlight.
+type SingleFlightConfig struct {
+	// TTL during which a successful result is returned without calling fn again, 0 disables the cache.
+	TTL time.Duration
+	// Clock is the real clock when nil.
+	Clock clock.PassiveClock
+}
+
+// SingleFlight runs a single call of fn per key at a time, the callers asking for the same key
+// meanwhile wait for it and share its result, e.g. a lookup of a VPC shared by many reconciles.
+type SingleFlight[K comparable, V any] struct {
+	config SingleFlightConfig
+
+	mutex sync.Mutex
+	calls map[K]*flightCall[V]
+	cache map[K]cachedResult[V]
+	// lastSweep is when the expired results were last removed from cache
+	lastSweep time.Time
+}
+
+type flightCall[V any] struct {
+	done chan struct{}
+	// waiters is the number of callers still waiting for the result, guarded by SingleFlight.mutex
+	waiters int
+	cancel  context.CancelFunc
+
+	value V
+	err   error
+	// panicked is set when fn panicked, it's raised again in the callers
+	panicked *panicError
+}
+
+// result returns the result of the call, or raises its panic again.
+func (call *flightCall[V]) result() (V, error) {
+	if call.panicked != nil {
+		panic(call.panicked)
+	}
+	return call.value, call.err
+}
+
+// panicError is a panic of fn with the stack of the goroutine which ran it, as the callers
+// raising it again have another one.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+type cachedResult[V any] struct {
+	value   V
+	expires time.Time
+}
+
+func NewSingleFlight[K comparable, V any](config SingleFlightConfig) *SingleFlight[K, V] {
+	if config.Clock == nil {
+		config.Clock = clock.RealClock{}
+	}
+	return &SingleFlight[K, V]{
+		config: config,
+		calls:  map[K]*flightCall[V]{},
+		cache:  map[K]cachedResult[V]{},
+	}
+}
+
+// Do returns the result of fn for key, calling it only if no call for key is running and no
+// result is cached. shared reports whether the result comes from a call started by another
+// caller or from the cache. When ctx is done first, Do returns ctx.Err() while the call goes
+// on for the other callers. fn gets a context which is cancelled once every caller gave up,
+// it carries the values of the ctx of the caller which started it. The next Do then starts a
+// new call rather than waiting for the cancelled one.
+// When fn panics, the panic is raised again in every caller waiting for it. If none is left,
+// it's raised in the goroutine of the call, which crashes the process like any other panic.
+func (s *SingleFlight[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (value V, shared bool, err error) {
+	s.mutex.Lock()
+	if s.config.TTL > 0 {
+		now := s.config.Clock.Now()
+		if now.Sub(s.lastSweep) >= s.config.TTL {
+			s.sweep(now)
+		}
+		if cached, ok := s.cache[key]; ok {
+			if now.Before(cached.expires) {
+				s.mutex.Unlock()
+				return cached.value, true, nil
+			}
+			delete(s.cache, key)
+		}
+	}
+	call, ok := s.calls[key]
+	if ok {
+		shared = true
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &flightCall[V]{done: make(chan struct{}), cancel: cancel}
+		s.calls[key] = call
+		go s.run(callCtx, key, call, fn)
+	}
+	call.waiters++
+	s.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		value, err = call.result()
+		return value, shared, err
+	case <-ctx.Done():
+		s.mutex.Lock()
+		select {
+		case <-call.done:
+			// the call ended meanwhile and counted this caller as a waiter
+			s.mutex.Unlock()
+			value, err = call.result()
+			return value, shared, err
+		default:
+		}
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			if s.calls[key] == call {
+				delete(s.calls, key)
+			}
+		}
+		s.mutex.Unlock()
+		var zero V
+		return zero, shared, ctx.Err()
+	}
+}
+
+// Forget drops the cached result of key, and lets the next Do start a new call even if one is
+// still running.
+func (s *SingleFlight[K, V]) Forget(key K) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.cache, key)
+	delete(s.calls, key)
+}
+
+// sweep removes the expired results from the cache, so the keys which are not asked for again
+// don't stay in it. The mutex must be held.
+func (s *SingleFlight[K, V]) sweep(now time.Time) {
+	s.lastSweep = now
+	for key, cached := range s.cache {
+		if !now.Before(cached.expires) {
+			delete(s.cache, key)
+		}
+	}
+}
+
+func (s *SingleFlight[K, V]) run(ctx context.Context, key K, call *flightCall[V], fn func(ctx context.Context) (V, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.panicked = &panicError{value: r, stack: debug.Stack()}
+		}
+		call.cancel()
+
+		s.mutex.Lock()
+		if s.calls[key] == call {
+			delete(s.calls, key)
+			if call.err == nil && call.panicked == nil && s.config.TTL > 0 {
+				s.cache[key] = cachedResult[V]{value: call.value, expires: s.config.Clock.Now().Add(s.config.TTL)}
+			}
+		}
+		// done is closed under the mutex, so the waiters still counted are bound to get the result
+		close(call.done)
+		waiters := call.waiters
+		s.mutex.Unlock()
+		if call.panicked != nil && waiters == 0 {
+			panic(call.panicked)
+		}
+	}()
+	call.value, call.err = fn(ctx)
+}
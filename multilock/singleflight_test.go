@@ -0,0 +1,245 @@
+package multilock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestSingleFlightShared(t *testing.T) {
+	flight := NewSingleFlight[string, string](SingleFlightConfig{})
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "vpc-1", nil
+	}
+
+	var wg sync.WaitGroup
+	var sharedCount atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, shared, err := flight.Do(context.Background(), "vpc", fn)
+			assert.NoError(t, err)
+			assert.Equal(t, "vpc-1", value)
+			if shared {
+				sharedCount.Add(1)
+			}
+		}()
+	}
+	waitFor(t, func() bool {
+		flight.mutex.Lock()
+		defer flight.mutex.Unlock()
+		return flight.calls["vpc"] != nil && flight.calls["vpc"].waiters == 10
+	})
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, int32(9), sharedCount.Load())
+
+	// without a TTL the next call runs fn again
+	_, shared, err := flight.Do(context.Background(), "vpc", fn)
+	require.NoError(t, err)
+	assert.False(t, shared)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestSingleFlightWaiterCancel(t *testing.T) {
+	flight := NewSingleFlight[string, int](SingleFlightConfig{})
+	release := make(chan struct{})
+	fnCancelled := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		select {
+		case <-release:
+			return 42, nil
+		case <-ctx.Done():
+			close(fnCancelled)
+			return 0, ctx.Err()
+		}
+	}
+
+	result := make(chan int)
+	go func() {
+		value, _, err := flight.Do(context.Background(), "flavors", fn)
+		assert.NoError(t, err)
+		result <- value
+	}()
+	waitFor(t, func() bool {
+		flight.mutex.Lock()
+		defer flight.mutex.Unlock()
+		return flight.calls["flavors"] != nil
+	})
+
+	// a waiter giving up doesn't cancel the call of the others
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, shared, err := flight.Do(ctx, "flavors", fn)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, shared)
+
+	close(release)
+	assert.Equal(t, 42, <-result)
+	select {
+	case <-fnCancelled:
+		t.Fatal("fn should not be cancelled while a caller waits")
+	default:
+	}
+}
+
+func TestSingleFlightAllWaitersCancel(t *testing.T) {
+	flight := NewSingleFlight[string, int](SingleFlightConfig{})
+	fnCancelled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	_, _, err := flight.Do(ctx, "flavors", func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		close(fnCancelled)
+		return 0, ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	select {
+	case <-fnCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("fn should be cancelled once every caller gave up")
+	}
+}
+
+func TestSingleFlightTTL(t *testing.T) {
+	fakeClock := clocktesting.NewFakePassiveClock(time.Now())
+	flight := NewSingleFlight[string, int](SingleFlightConfig{TTL: time.Minute, Clock: fakeClock})
+	calls := 0
+	fn := func(ctx context.Context) (int, error) {
+		calls++
+		return calls, nil
+	}
+
+	value, shared, err := flight.Do(context.Background(), "flavors", fn)
+	require.NoError(t, err)
+	assert.Equal(t, 1, value)
+	assert.False(t, shared)
+
+	value, shared, err = flight.Do(context.Background(), "flavors", fn)
+	require.NoError(t, err)
+	assert.Equal(t, 1, value)
+	assert.True(t, shared, "a cached result is shared")
+
+	fakeClock.SetTime(fakeClock.Now().Add(time.Minute))
+	value, _, err = flight.Do(context.Background(), "flavors", fn)
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+
+	flight.Forget("flavors")
+	value, _, err = flight.Do(context.Background(), "flavors", fn)
+	require.NoError(t, err)
+	assert.Equal(t, 3, value)
+}
+
+func TestSingleFlightErrorNotCached(t *testing.T) {
+	flight := NewSingleFlight[string, int](SingleFlightConfig{TTL: time.Minute})
+	boom := errors.New("boom")
+	_, _, err := flight.Do(context.Background(), "flavors", func(ctx context.Context) (int, error) {
+		return 0, boom
+	})
+	assert.ErrorIs(t, err, boom)
+
+	value, shared, err := flight.Do(context.Background(), "flavors", func(ctx context.Context) (int, error) {
+		return 7, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 7, value)
+	assert.False(t, shared)
+}
+
+func TestSingleFlightPanic(t *testing.T) {
+	flight := NewSingleFlight[string, int](SingleFlightConfig{TTL: time.Minute})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		<-release
+		panic("unexpected")
+	}
+
+	panics := make(chan interface{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer func() {
+				panics <- recover()
+			}()
+			_, _, _ = flight.Do(context.Background(), "flavors", fn)
+		}()
+	}
+	waitFor(t, func() bool {
+		flight.mutex.Lock()
+		defer flight.mutex.Unlock()
+		return flight.calls["flavors"] != nil && flight.calls["flavors"].waiters == 2
+	})
+	close(release)
+	for i := 0; i < 2; i++ {
+		err, ok := (<-panics).(error)
+		require.True(t, ok, "every caller panics with an error")
+		assert.Contains(t, err.Error(), "unexpected")
+		assert.Contains(t, err.Error(), "singleflight_test.go", "the stack of fn is kept")
+	}
+
+	value, shared, err := flight.Do(context.Background(), "flavors", func(ctx context.Context) (int, error) {
+		return 7, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 7, value)
+	assert.False(t, shared, "a panic is not cached")
+}
+
+func TestSingleFlightNewCallAfterCancel(t *testing.T) {
+	flight := NewSingleFlight[string, int](SingleFlightConfig{})
+	release := make(chan struct{})
+	defer close(release)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := flight.Do(ctx, "flavors", func(ctx context.Context) (int, error) {
+		// ignores the cancellation
+		<-release
+		return 1, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	value, shared, err := flight.Do(context.Background(), "flavors", func(ctx context.Context) (int, error) {
+		return 2, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, value, "the cancelled call is not joined")
+	assert.False(t, shared)
+}
+
+func TestSingleFlightSweepsExpired(t *testing.T) {
+	fakeClock := clocktesting.NewFakePassiveClock(time.Now())
+	flight := NewSingleFlight[string, int](SingleFlightConfig{TTL: time.Minute, Clock: fakeClock})
+	fn := func(ctx context.Context) (int, error) {
+		return 1, nil
+	}
+	for _, key := range []string{"flavors", "images", "zones"} {
+		_, _, err := flight.Do(context.Background(), key, fn)
+		require.NoError(t, err)
+	}
+	assert.Len(t, flight.cache, 3)
+
+	fakeClock.SetTime(fakeClock.Now().Add(time.Minute))
+	_, _, err := flight.Do(context.Background(), "vpc", fn)
+	require.NoError(t, err)
+	flight.mutex.Lock()
+	defer flight.mutex.Unlock()
+	assert.Len(t, flight.cache, 1, "the results of the other keys expired")
+	assert.Contains(t, flight.cache, "vpc")
+}
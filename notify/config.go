@@ -1,5 +1,7 @@
 package notify
 
+import "net/url"
+
 type AlertConfig struct {
 	Title    string            `mapstructure:"title"`
 	Metadata map[string]string `mapstructure:"metadata"`
@@ -16,3 +18,22 @@ type TelegramConfig struct {
 	ChatID   int64  `mapstructure:"chatId"`
 	ProxyURL string `mapstructure:"proxyUrl"`
 }
+
+// Secrets returns the secret values of the config, to be registered in a log redactor.
+func (c *AlertConfig) Secrets() []string {
+	var secrets []string
+	if c.MSTeams != nil && c.MSTeams.WebhookURL != "" {
+		secrets = append(secrets, c.MSTeams.WebhookURL)
+	}
+	if c.Telegram != nil && c.Telegram.BotToken != "" {
+		secrets = append(secrets, c.Telegram.BotToken)
+	}
+	if c.Telegram != nil && c.Telegram.ProxyURL != "" {
+		if proxyURL, err := url.Parse(c.Telegram.ProxyURL); err == nil && proxyURL.User != nil {
+			if password, ok := proxyURL.User.Password(); ok {
+				secrets = append(secrets, password)
+			}
+		}
+	}
+	return secrets
+}
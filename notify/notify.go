@@ -16,12 +16,26 @@ import (
 	"github.com/anngdinh/operator-helper/notify/workerpool"
 )
 
+// SendFailedMessage is the message logged when a notification could not be sent, a hook forwarding
+// the error logs to a Notifier must skip it so a failing notifier doesn't notify about itself.
+const SendFailedMessage = "failed to send notification"
+
 // Notifier interface for sending notifications
 type Notifier interface {
 	// Send sends a notification with the given status, fields, and content
 	Send(status Status, fields map[string]string, content string)
 }
 
+// SyncNotifier is a Notifier which can also send a notification before returning,
+// e.g. right before the process exits when Send would only queue it.
+type SyncNotifier interface {
+	Notifier
+	// SendSync sends the notification like Send, and returns once it's sent, failed or ctx is done.
+	SendSync(ctx context.Context, status Status, fields map[string]string, content string) error
+}
+
+var _ SyncNotifier = &notifierImpl{}
+
 type notifierImpl struct {
 	ctx           context.Context
 	sendAlertPool *workerpool.Pool
@@ -91,6 +105,30 @@ func NewNotifier(ctx context.Context, alertConfig *AlertConfig, logger logr.Logg
 
 // Send creates and sends a notification with the given status, fields, and content
 func (s *notifierImpl) Send(status Status, fields map[string]string, content string) {
+	title, body := s.build(status, fields, content)
+	s.sendAlertPool.AddTask(
+		workerpool.NewTask(func() error {
+			err := s.notifier.Send(s.ctx, title, body)
+			if err != nil {
+				s.logger.Error(err, SendFailedMessage)
+			}
+			return err
+		}),
+	)
+}
+
+// SendSync creates and sends a notification without the worker pool, so it's not retried
+func (s *notifierImpl) SendSync(ctx context.Context, status Status, fields map[string]string, content string) error {
+	title, body := s.build(status, fields, content)
+	err := s.notifier.Send(ctx, title, body)
+	if err != nil {
+		s.logger.Error(err, SendFailedMessage)
+	}
+	return err
+}
+
+// build returns the title and the body of a notification
+func (s *notifierImpl) build(status Status, fields map[string]string, content string) (string, string) {
 	notification := s.msgBuilder.NewNotification(status)
 
 	// Auto-add timestamp
@@ -102,17 +140,5 @@ func (s *notifierImpl) Send(status Status, fields map[string]string, content str
 	if content != "" {
 		notification.WithContent(content)
 	}
-
-	title := notification.GetTitle()
-	body := notification.GetBodyTelegram()
-
-	s.sendAlertPool.AddTask(
-		workerpool.NewTask(func() error {
-			err := s.notifier.Send(s.ctx, title, body)
-			if err != nil {
-				s.logger.Error(err, "failed to send notification")
-			}
-			return err
-		}),
-	)
+	return notification.GetTitle(), notification.GetBodyTelegram()
 }